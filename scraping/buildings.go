@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// building is a dorm building sub-page linked from the site index.
+type building struct {
+	id  string // e.g. "gakuryo-a"
+	url string // absolute URL of the building's page
+}
+
+// listBuildingsCommand implements the `list-buildings` subcommand. It prints the building
+// sub-pages linked from the dorm index page.
+func listBuildingsCommand(args []string) error {
+	fs := flag.NewFlagSet("list-buildings", flag.ExitOnError)
+	indexURL := fs.String("index", "https://www.off.niihama-nct.ac.jp/", "dorm index page that links to the building pages")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s list-buildings [-index url]\n", filepath.Base(flag.CommandLine.Name()))
+		fs.PrintDefaults()
+	}
+	setupHTTP := httpFlags(fs)
+	fs.Parse(args)
+	if err := setupHTTP(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	page, err := fetchPage(ctx, *indexURL)
+	if err != nil {
+		return err
+	}
+	buildings, err := getBuildings(page, *indexURL)
+	if err != nil {
+		return err
+	}
+	if len(buildings) == 0 {
+		return fmt.Errorf("no building pages found on %s", *indexURL)
+	}
+	for _, b := range buildings {
+		fmt.Printf("%s\t%s\n", b.id, b.url)
+	}
+	return nil
+}
+
+// fetchPage returns the body of the page at `pageURL`. The request is abandoned when `ctx` is done.
+func fetchPage(ctx context.Context, pageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("could not fetch %s: %s", pageURL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// getBuildings returns the building pages (gakuryo-a, gakuryo-b, ...) linked from index page
+// `page`, in the order they first appear. Relative links are resolved against `indexURL`.
+func getBuildings(page []byte, indexURL string) ([]building, error) {
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var buildings []building
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		ref, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		abs := base.ResolveReference(ref)
+		m := reBuildingID.FindStringSubmatch(abs.Path)
+		if m == nil || seen[m[1]] {
+			return
+		}
+		seen[m[1]] = true
+		abs.Path = m[0]
+		abs.RawQuery, abs.Fragment = "", ""
+		buildings = append(buildings, building{id: m[1], url: abs.String()})
+	})
+	return buildings, nil
+}
+
+var reBuildingID = regexp.MustCompile(`^.*/(gakuryo-[a-z0-9]+)/`)
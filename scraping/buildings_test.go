@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleIndex is a cut-down copy of the dorm index page.
+const sampleIndex = `<html><head><title>学生寮</title></head><body>
+<ul class="nav">
+<li><a href="/">トップ</a></li>
+<li><a href="gakuryo-a/">A寮</a></li>
+<li><a href="https://www.off.niihama-nct.ac.jp/gakuryo-b/index.html">B寮</a></li>
+<li><a href="./gakuryo-c/kondate/ryoushoku.html?v=2#menu">C寮の献立</a></li>
+<li><a href="/gakuryo-a/kondate/">A寮の献立</a></li>
+<li><a href="/news/gakuryo-info.html">お知らせ</a></li>
+<li><a>リンクなし</a></li>
+</ul>
+</body></html>`
+
+func TestGetBuildings(t *testing.T) {
+	got, err := getBuildings([]byte(sampleIndex), "https://www.off.niihama-nct.ac.jp/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []building{
+		{id: "gakuryo-a", url: "https://www.off.niihama-nct.ac.jp/gakuryo-a/"},
+		{id: "gakuryo-b", url: "https://www.off.niihama-nct.ac.jp/gakuryo-b/"},
+		{id: "gakuryo-c", url: "https://www.off.niihama-nct.ac.jp/gakuryo-c/"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getBuildings = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetBuildingsNone(t *testing.T) {
+	got, err := getBuildings([]byte("<html><body>工事中</body></html>"), "https://www.off.niihama-nct.ac.jp/")
+	if err != nil || len(got) != 0 {
+		t.Errorf("getBuildings = %+v, %v, want none", got, err)
+	}
+}
+
+func TestFetchPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, sampleIndex)
+	}))
+	defer srv.Close()
+
+	page, err := fetchPage(context.Background(), srv.URL+"/")
+	if err != nil || string(page) != sampleIndex {
+		t.Errorf("fetchPage = %d bytes, %v, want the index page", len(page), err)
+	}
+	if _, err := fetchPage(context.Background(), srv.URL+"/missing/"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("fetchPage of a missing index = %v, want a 404 error", err)
+	}
+}
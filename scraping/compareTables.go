@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+// EqualTables returns true if `a` and `b` have the same shape and their cells are equal after
+// normalize(). When they differ, the returned string describes the first difference found, with
+// 0-offset row and column coordinates.
+func EqualTables(a, b stringTable) (bool, string) {
+	if len(a) != len(b) {
+		return false, fmt.Sprintf("height %d != %d", len(a), len(b))
+	}
+	for y := range a {
+		if len(a[y]) != len(b[y]) {
+			return false, fmt.Sprintf("row[%d] width %d != %d", y, len(a[y]), len(b[y]))
+		}
+		for x := range a[y] {
+			if normalize(a[y][x]) != normalize(b[y][x]) {
+				return false, fmt.Sprintf("cell[%d][%d] %q != %q", y, x, a[y][x], b[y][x])
+			}
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestEqualTables(t *testing.T) {
+	a := stringTable{{"日付", "朝食"}, {"4/1", "パン"}}
+	tests := []struct {
+		name string
+		b    stringTable
+		want bool
+		diff string
+	}{
+		{"equal", stringTable{{"日付", "朝食"}, {"4/1", "パン"}}, true, ""},
+		// Cells are compared after normalize(), so full-width digits and extra spaces match.
+		{"equal after normalize", stringTable{{"日付", "朝食"}, {"４/１", " パン  "}}, true, ""},
+		{"different height", stringTable{{"日付", "朝食"}}, false, "height 2 != 1"},
+		{"different row width", stringTable{{"日付", "朝食"}, {"4/1", "パン", ""}}, false, "row[1] width 2 != 3"},
+		{"different cell", stringTable{{"日付", "朝食"}, {"4/1", "ご飯"}}, false, `cell[1][1] "パン" != "ご飯"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, diff := EqualTables(a, tc.b)
+			if got != tc.want || diff != tc.diff {
+				t.Errorf("EqualTables = %v, %q, want %v, %q", got, diff, tc.want, tc.diff)
+			}
+		})
+	}
+}
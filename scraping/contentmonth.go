@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eraStartYears are the Gregorian years before the first year of the Japanese eras used on menus,
+// so that 令和6年 is 2018+6 = 2024.
+var eraStartYears = map[string]int{
+	"令和": 2018,
+	"平成": 1988,
+}
+
+// reMenuYearMonth matches a year and month in menu text, e.g. "2024年4月", "令和6年4月" or
+// "R6.4". A bare "4月" is matched as well, with no year.
+var reMenuYearMonth = regexp.MustCompile(`(?:(令和|平成|R|H)\s*(\d{1,2}|元)|(\d{4}))\s*[年.]\s*(\d{1,2})\s*月?|(\d{1,2})\s*月`)
+
+// menuMonth returns the year and month of the first date found in page text `text`. The year is
+// 0 if only a month, like "4月の献立", is found. ok is false if no month is found.
+func menuMonth(text string) (year int, month time.Month, ok bool) {
+	for _, line := range strings.Split(text, "\n") {
+		m := reMenuYearMonth.FindStringSubmatch(normalize(line))
+		if m == nil {
+			continue
+		}
+		monthText := m[4]
+		switch {
+		case m[1] != "":
+			era := m[1]
+			switch era {
+			case "R":
+				era = "令和"
+			case "H":
+				era = "平成"
+			}
+			n := 1
+			if m[2] != "元" {
+				n, _ = strconv.Atoi(m[2])
+			}
+			year = eraStartYears[era] + n
+		case m[3] != "":
+			year, _ = strconv.Atoi(m[3])
+		default:
+			monthText = m[5]
+		}
+		n, _ := strconv.Atoi(monthText)
+		if n < 1 || n > 12 {
+			continue
+		}
+		return year, time.Month(n), true
+	}
+	return 0, 0, false
+}
+
+// contentCSVRoot returns the CSV root in the default layout, <csvDir>/<year>PDF/<mon>/<mon>, for
+// a menu of `month` in `year`, e.g. <csvDir>/2024PDF/apr/apr. A `year` of 0 keeps the year
+// directory of `inPath`.
+func contentCSVRoot(csvDir, inPath string, year int, month time.Month) (string, error) {
+	yearDir := fmt.Sprintf("%dPDF", year)
+	if year == 0 {
+		var err error
+		if yearDir, err = extractDirectory(inPath, -2); err != nil {
+			return "", fmt.Errorf("failed to extract directory: %w", err)
+		}
+	}
+	mon := strings.ToLower(month.String()[:3])
+	return filepath.Join(csvDir, yearDir, mon, mon), nil
+}
+
+// menuCSVRoot returns a CSV root function that files the CSVs of the PDFs named for the month of
+// `menu` under its year, e.g. <csvDir>/2025PDF/jan/jan for 2024PDF/jan.pdf fetched for January
+// 2025, and uses defaultCSVRoot for the others.
+func menuCSVRoot(csvDir string, menu time.Time) func(inPath string) (string, error) {
+	root := defaultCSVRoot(csvDir)
+	return func(inPath string) (string, error) {
+		name, err := extractDirectory(inPath, -1)
+		if err != nil {
+			return "", err
+		}
+		if month, err := parseMonth(name); err == nil && month == menu.Month() {
+			return contentCSVRoot(csvDir, inPath, menu.Year(), month)
+		}
+		return root(inPath)
+	}
+}
+
+// pathMonth returns the year and month of the menu PDF at `inPath` in the site's layout, e.g. 2024
+// and April for PDF/2024PDF/apr.pdf. Either is 0 if it isn't in the path.
+func pathMonth(inPath string) (year int, month time.Month) {
+	if yearDir, err := extractDirectory(inPath, -2); err == nil && len(yearDir) >= 4 {
+		year, _ = strconv.Atoi(yearDir[:4])
+	}
+	if name, err := extractDirectory(inPath, -1); err == nil {
+		month, _ = parseMonth(name)
+	}
+	return year, month
+}
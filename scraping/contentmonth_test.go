@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMenuMonth(t *testing.T) {
+	tests := []struct {
+		text  string
+		year  int
+		month time.Month
+		ok    bool
+	}{
+		{"2024年4月 寮食献立表", 2024, time.April, true},
+		{"２０２４年１０月の献立", 2024, time.October, true},
+		{"令和6年5月 献立表", 2024, time.May, true},
+		{"令和 6 年 5 月", 2024, time.May, true},
+		{"令和元年10月", 2019, time.October, true},
+		{"R6.4 献立", 2024, time.April, true},
+		{"R元.12", 2019, time.December, true},
+		{"平成31年4月", 2019, time.April, true},
+		{"H30.3", 2018, time.March, true},
+		{"4月の献立", 0, time.April, true},
+		// The first line with a valid month wins.
+		{"寮食献立表\n13月\n令和6年6月\n2024年7月", 2024, time.June, true},
+		{"寮食献立表", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tc := range tests {
+		year, month, ok := menuMonth(tc.text)
+		if year != tc.year || month != tc.month || ok != tc.ok {
+			t.Errorf("menuMonth(%q) = %d, %s, %v, want %d, %s, %v", tc.text, year, month, ok, tc.year, tc.month, tc.ok)
+		}
+	}
+}
+
+func TestResultCSVRootContentMonthWins(t *testing.T) {
+	csvDir := filepath.Join("out", "csv")
+	// The file is named for April but its first page is the May menu.
+	inPath := filepath.Join("PDF", "2024PDF", "apr.pdf")
+	tests := []struct {
+		name             string
+		monthFromContent bool
+		year             int
+		month            time.Month
+		want             string
+	}{
+		{"path by default", false, 2024, time.May, filepath.Join(csvDir, "2024PDF", "apr", "apr")},
+		{"content month wins", true, 2024, time.May, filepath.Join(csvDir, "2024PDF", "may", "may")},
+		{"content year wins", true, 2025, time.January, filepath.Join(csvDir, "2025PDF", "jan", "jan")},
+		{"month without a year keeps the path's year", true, 0, time.May, filepath.Join(csvDir, "2024PDF", "may", "may")},
+		{"no month on the page keeps the path", true, 0, 0, filepath.Join(csvDir, "2024PDF", "apr", "apr")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{CSVDir: csvDir, MonthFromContent: tc.monthFromContent}
+			result := docTables{year: tc.year, month: tc.month}
+			got, err := resultCSVRoot(inPath, result, defaultCSVRoot(csvDir), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("resultCSVRoot = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// mealCorrection is an entry of a corrections file: the corrected dishes or calories of the meal
+// of one date and type, for a menu that was extracted wrong and can't be fixed at the source.
+type mealCorrection struct {
+	Date     string   `json:"date"` // YYYY-MM-DD
+	Type     string   `json:"type"` // breakfast, lunch or dinner
+	Items    []string `json:"items,omitempty"`
+	Calories *float64 `json:"calories,omitempty"`
+}
+
+// mealCorrections are the corrections of a corrections file, by date and meal type.
+type mealCorrections map[mealKey]mealCorrection
+
+// loadCorrections returns the corrections in JSON corrections file `path`, an array of
+// mealCorrection. Each entry must correct the items or calories of a valid date and meal type.
+func loadCorrections(path string) (mealCorrections, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []mealCorrection
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	corrections := make(mealCorrections, len(entries))
+	for i, c := range entries {
+		if _, err := time.Parse("2006-01-02", c.Date); err != nil {
+			return nil, fmt.Errorf("%s: correction %d: bad date %q", path, i+1, c.Date)
+		}
+		mealType, ok := mealTypeNamed(c.Type)
+		if !ok {
+			return nil, fmt.Errorf("%s: correction %d: bad meal type %q", path, i+1, c.Type)
+		}
+		if c.Items == nil && c.Calories == nil {
+			return nil, fmt.Errorf("%s: correction %d: no items or calories for %s %s", path, i+1, c.Date, c.Type)
+		}
+		corrections[mealKey{c.Date, mealType}] = c
+	}
+	return corrections, nil
+}
+
+// mealTypeNamed returns the meal type whose String() is `name`, e.g. Lunch for "lunch".
+func mealTypeNamed(name string) (MealType, bool) {
+	for _, h := range mealTypeHeaders {
+		if strings.EqualFold(name, h.mealType.String()) {
+			return h.mealType, true
+		}
+	}
+	return 0, false
+}
+
+// apply returns `meals` with the corrections of `c` applied to the meals of the same date and
+// type, and logs each one applied. Corrected items replace the dishes, weights and all, keeping
+// only the footnotes they still mark, and corrected calories replace the menu's figure.
+func (c mealCorrections) apply(meals []Meal) []Meal {
+	if len(c) == 0 {
+		return meals
+	}
+	corrected := make([]Meal, len(meals))
+	for i, meal := range meals {
+		fix, ok := c[meal.key()]
+		if ok {
+			if fix.Items != nil {
+				log.Printf("correction: %s %s items %q -> %q", fix.Date, meal.Type, meal.Items, fix.Items)
+				meal.Items = append([]string(nil), fix.Items...)
+				meal.Dishes = nil
+				meal.Footnotes = footnotesOf(meal.Items, meal.Footnotes)
+				meal.Closed = false
+			}
+			if fix.Calories != nil {
+				log.Printf("correction: %s %s calories %g -> %g", fix.Date, meal.Type, meal.Calories, *fix.Calories)
+				meal.Calories, meal.CaloriesOK = *fix.Calories, true
+			}
+		}
+		corrected[i] = meal
+	}
+	return corrected
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyCorrections(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"corrections.json": `[
+		{"date": "2024-04-15", "type": "lunch", "items": ["カレーライス", "サラダ"], "calories": 780},
+		{"date": "2024-04-16", "type": "dinner", "calories": 650},
+		{"date": "2024-05-01", "type": "breakfast", "items": ["パン"]}
+	]`})
+	corrections, err := loadCorrections(filepath.Join(dir, "corrections.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	meals := []Meal{
+		{Date: day(15), Type: Breakfast, Items: []string{"ご飯"}},
+		{Date: day(15), Type: Lunch, Items: []string{"カレ一ライス"}, Dishes: []Item{{Name: "カレ一ライス", Grams: 300}}},
+		{Date: day(16), Type: Dinner, Items: []string{"焼き魚"}, Calories: 6500, CaloriesOK: true},
+	}
+	got := corrections.apply(meals)
+	want := []Meal{
+		meals[0],
+		{Date: day(15), Type: Lunch, Items: []string{"カレーライス", "サラダ"}, Calories: 780, CaloriesOK: true},
+		{Date: day(16), Type: Dinner, Items: []string{"焼き魚"}, Calories: 650, CaloriesOK: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("corrected meals =\n%+v\nwant\n%+v", got, want)
+	}
+	if meals[1].Items[0] != "カレ一ライス" {
+		t.Errorf("apply changed its input: %q", meals[1].Items)
+	}
+	for _, line := range []string{
+		`correction: 2024-04-15 lunch items ["カレ一ライス"] -> ["カレーライス" "サラダ"]`,
+		"correction: 2024-04-16 dinner calories 6500 -> 650",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("log = %q, want it to contain %q", logs, line)
+		}
+	}
+	if strings.Count(logs.String(), "correction:") != 3 {
+		t.Errorf("log = %q, want 3 corrections", logs)
+	}
+}
+
+func TestLoadCorrectionsRejectsBadEntries(t *testing.T) {
+	for name, entry := range map[string]string{
+		"bad date":         `{"date": "4/15", "type": "lunch", "items": ["カレー"]}`,
+		"bad type":         `{"date": "2024-04-15", "type": "昼食", "items": ["カレー"]}`,
+		"nothing to apply": `{"date": "2024-04-15", "type": "lunch"}`,
+	} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"corrections.json": "[" + entry + "]"})
+		if _, err := loadCorrections(filepath.Join(dir, "corrections.json")); err == nil {
+			t.Errorf("%s: loadCorrections succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// closedDayLine is the line of a day text file for a day the cafeteria is closed for every meal.
+const closedDayLine = "本日休業"
+
+// saveDayTexts writes a plaintext menu file for each day of `meals` to `dir`, named like
+// 2024-04-15.txt. The files are for simple displays such as digital signage; a file written for
+// the same day before, e.g. from the uncorrected menu, is replaced.
+func saveDayTexts(dir string, meals []Meal) error {
+	var days []string
+	byDay := make(map[string][]Meal)
+	for _, meal := range meals {
+		day := meal.Date.Format("2006-01-02")
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], meal)
+	}
+	for _, day := range days {
+		dayMeals := byDay[day]
+		dayPath := filepath.Join(dir, day+".txt")
+		if err := ioutil.WriteFile(dayPath, []byte(dayText(dayMeals[0].Date, dayMeals)), 0666); err != nil {
+			return fmt.Errorf("failed to write dayPath=%q err=%w", dayPath, err)
+		}
+	}
+	return nil
+}
+
+// dayText returns the plaintext menu of the meals of `date` in `meals`: a heading line with the
+// date, then the dayLines of `meals`.
+func dayText(date time.Time, meals []Meal) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sの献立\n", japaneseDate(date))
+	for _, line := range dayLines(meals) {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// dayLines returns a line for each of breakfast, lunch and dinner of one day's `meals` with its
+// dishes, or "なし" if there is none that day. A day the cafeteria is closed for every meal has
+// just the closedDayLine instead.
+func dayLines(meals []Meal) []string {
+	byType := make(map[MealType]Meal)
+	closed := len(meals) > 0
+	for _, meal := range meals {
+		byType[meal.Type] = meal
+		closed = closed && meal.Closed
+	}
+	if closed {
+		return []string{closedDayLine}
+	}
+	var lines []string
+	for _, h := range mealTypeHeaders {
+		meal, ok := byType[h.mealType]
+		lines = append(lines, fmt.Sprintf("%s: %s", h.header, mealLine(meal, ok)))
+	}
+	return lines
+}
+
+// japaneseDate returns `date` as its month, day and weekday, e.g. "4月15日(月)".
+func japaneseDate(date time.Time) string {
+	return fmt.Sprintf("%d月%d日(%s)", date.Month(), date.Day(), japaneseWeekdays[date.Weekday()])
+}
+
+// japaneseWeekdays are the one-character Japanese names of the days of the week, from Sunday.
+var japaneseWeekdays = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+// mealLine returns the text of `meal` in a day text file: its event and dishes, then its
+// calories. ok is false if there is no meal.
+func mealLine(meal Meal, ok bool) string {
+	switch {
+	case !ok:
+		return "なし"
+	case meal.Closed:
+		return "休業"
+	}
+	line := strings.Join(meal.Items, "、")
+	if meal.Event != "" {
+		line = "【" + meal.Event + "】" + line
+	}
+	if meal.CaloriesOK {
+		line += fmt.Sprintf(" (%gkcal)", meal.Calories)
+	}
+	return line
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveDayTexts(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	meals := []Meal{
+		{Date: day(15), Type: Breakfast, Items: []string{"ご飯", "味噌汁"}},
+		{Date: day(15), Type: Dinner, Items: []string{"ステーキ", "ケーキ"}, Event: "誕生日メニュー",
+			Calories: 900, CaloriesOK: true},
+		{Date: day(15), Type: Lunch, Closed: true},
+		{Date: day(20), Type: Lunch, Closed: true},
+		{Date: day(20), Type: Dinner, Closed: true},
+	}
+	dir := t.TempDir()
+	if err := saveDayTexts(dir, meals); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"2024-04-15.txt": "4月15日(月)の献立\n" +
+			"朝食: ご飯、味噌汁\n" +
+			"昼食: 休業\n" +
+			"夕食: 【誕生日メニュー】ステーキ、ケーキ (900kcal)\n",
+		"2024-04-20.txt": "4月20日(土)の献立\n本日休業\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("wrote %d files, want 2", len(entries))
+	}
+}
+
+func TestDayTextMissingMeals(t *testing.T) {
+	date := time.Date(2024, time.April, 16, 0, 0, 0, 0, time.Local)
+	got := dayText(date, []Meal{{Date: date, Type: Lunch, Items: []string{"カレー"}}})
+	want := "4月16日(火)の献立\n朝食: なし\n昼食: カレー\n夕食: なし\n"
+	if got != want {
+		t.Errorf("dayText =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+)
+
+// uniqueByContent returns `paths` with every file whose content is identical to an earlier one
+// removed, logging each duplicate found. This stops the same PDF linked under two months from
+// being extracted twice.
+func uniqueByContent(paths []string) ([]string, error) {
+	seen := make(map[string]string)
+	var unique []string
+	for _, path := range paths {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := seen[sum]; ok {
+			log.Printf("%s: same content as %s, skipping", path, first)
+			continue
+		}
+		seen[sum] = path
+		unique = append(unique, path)
+	}
+	return unique, nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the contents of file `filename`.
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueByContent(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	files := []struct {
+		name, data string
+	}{
+		{"2024PDF/jul.pdf", "%PDF-1.4\n% summer menu\n"},
+		{"2024PDF/apr.pdf", "%PDF-1.4\n% april menu\n"},
+		// The July and August links point at the same summer menu under other names.
+		{"2024PDF/aug.pdf", "%PDF-1.4\n% summer menu\n"},
+		{"2024PDF/summer-copy.pdf", "%PDF-1.4\n% summer menu\n"},
+	}
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	got, err := uniqueByContent(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := paths[:2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueByContent = %q, want %q", got, want)
+	}
+	for _, dup := range paths[2:] {
+		if !strings.Contains(logs.String(), dup+": same content as "+paths[0]) {
+			t.Errorf("duplicate %s not logged: %q", dup, logs.String())
+		}
+	}
+}
+
+func TestUniqueByContentMissingFile(t *testing.T) {
+	if _, err := uniqueByContent([]string{filepath.Join(t.TempDir(), "missing.pdf")}); err == nil {
+		t.Error("uniqueByContent of a missing file succeeded")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// freeDiskBytes returns the number of bytes available to the user on the filesystem containing
+// `path`. It is a variable so that it can be replaced by a stub.
+var freeDiskBytes = diskFree
+
+// checkFreeSpace returns an error if the filesystem containing `path` has less than `minMB`
+// megabytes free. `path` needn't exist yet; the space is checked on its nearest existing parent,
+// which is where it will be created.
+func checkFreeSpace(path string, minMB uint64) error {
+	if minMB == 0 {
+		return nil
+	}
+	free, err := freeDiskBytes(existingParent(path))
+	if err != nil {
+		return fmt.Errorf("could not get free disk space for %q: %w", path, err)
+	}
+	if free < minMB*1024*1024 {
+		return fmt.Errorf("only %.1f MB free on %q, need at least %d MB",
+			float64(free)/1024.0/1024.0, path, minMB)
+	}
+	return nil
+}
+
+// existingParent returns `path` if it exists, or else its nearest parent directory that does.
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubFreeDisk replaces freeDiskBytes for the rest of the test with one that reports `free` bytes
+// and records the path it was asked about.
+func stubFreeDisk(t *testing.T, free uint64) *string {
+	var asked string
+	saved := freeDiskBytes
+	freeDiskBytes = func(path string) (uint64, error) {
+		asked = path
+		return free, nil
+	}
+	t.Cleanup(func() { freeDiskBytes = saved })
+	return &asked
+}
+
+func TestCheckFreeSpaceNewWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	asked := stubFreeDisk(t, 200*1024*1024)
+	workDir := filepath.Join(dir, "runs", "2024-04-01")
+	if err := checkFreeSpace(workDir, 100); err != nil {
+		t.Fatalf("checkFreeSpace(%q) = %v, want nil", workDir, err)
+	}
+	if *asked != dir {
+		t.Errorf("free space checked on %q, want the existing parent %q", *asked, dir)
+	}
+}
+
+func TestCheckFreeSpaceTooLittle(t *testing.T) {
+	dir := t.TempDir()
+	stubFreeDisk(t, 50*1024*1024)
+	err := checkFreeSpace(dir, 100)
+	if err == nil || !strings.Contains(err.Error(), "50.0 MB free") {
+		t.Errorf("checkFreeSpace with 50 MB free = %v, want an error reporting 50.0 MB", err)
+	}
+}
+
+func TestCheckFreeSpaceDisabled(t *testing.T) {
+	asked := stubFreeDisk(t, 0)
+	if err := checkFreeSpace(t.TempDir(), 0); err != nil {
+		t.Errorf("checkFreeSpace with -min-free-mb 0 = %v, want nil", err)
+	}
+	if *asked != "" {
+		t.Errorf("free space was checked with -min-free-mb 0")
+	}
+}
+
+func TestDiskFreeRealFilesystem(t *testing.T) {
+	if _, err := diskFree(t.TempDir()); err != nil {
+		t.Errorf("diskFree = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+)
+
+// Exit codes returned by the scraper. Scripts can rely on these to tell apart the reasons a run
+// didn't produce a menu. They are documented to users by exitCodeUsage.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitNoMenu   = 2
+	exitLicense  = 3
+	exitDeadline = 4
+	exitNoTables = 5
+	exitPartial  = 6
+	exitDrift    = 7
+)
+
+// Sentinel errors mapped to exit codes by exitCode(). Wrap them with %w to add detail.
+var (
+	errNoMenu      = errors.New("no menu published")
+	errLicense     = errors.New("license error")
+	errRunDeadline = errors.New("run deadline exceeded")
+	errNoTables    = errors.New("no tables extracted")
+	errPartial     = errors.New("some menu PDFs failed to download")
+	errMealDrift   = errors.New("parsed meals differ from the store")
+)
+
+// exitCodeUsage is added to the -help message.
+const exitCodeUsage = `Exit codes:
+  0  success
+  1  any other error
+  2  no menu has been published
+  3  license/metering error
+  4  run deadline exceeded
+  5  no tables extracted (with -strict)
+  6  some menu PDFs failed to download; the others were extracted
+  7  compare-store: the parsed meals differ from the stored ones`
+
+// exitCode returns the process exit code for `err`. A context.DeadlineExceeded that reached main
+// without errRunDeadline still counts as the run deadline, the only deadline on the run context.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errNoMenu):
+		return exitNoMenu
+	case errors.Is(err, errLicense):
+		return exitLicense
+	case errors.Is(err, errRunDeadline), errors.Is(err, context.DeadlineExceeded):
+		return exitDeadline
+	case errors.Is(err, errNoTables):
+		return exitNoTables
+	case errors.Is(err, errPartial):
+		return exitPartial
+	case errors.Is(err, errMealDrift):
+		return exitDrift
+	}
+	return exitError
+}
+
+// fatal logs `err` and exits with exitCode(`err`).
+func fatal(err error) {
+	log.Println(err)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"other", errors.New("boom"), exitError},
+		{"no menu", errNoMenu, exitNoMenu},
+		{"license", errLicense, exitLicense},
+		{"run deadline", errRunDeadline, exitDeadline},
+		{"context deadline", context.DeadlineExceeded, exitDeadline},
+		{"no tables", errNoTables, exitNoTables},
+		{"wrapped no menu", fmt.Errorf("getting the menu PDFs: %w", errNoMenu), exitNoMenu},
+		{"wrapped license", fmt.Errorf("%w: bad key", errLicense), exitLicense},
+		{"wrapped context deadline", fmt.Errorf("extracting tables: %w", context.DeadlineExceeded), exitDeadline},
+		{"joined no tables", errors.Join(errors.New("one file"), errNoTables), exitNoTables},
+		{"partial download", fmt.Errorf("%w: %w", errPartial, errors.New("may.pdf: 404")), exitPartial},
+		{"meal drift", fmt.Errorf("%w: 2 meals differ", errMealDrift), exitDrift},
+		{"canceled", context.Canceled, exitError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -7,20 +7,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"runtime/pprof"
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/text/unicode/norm"
 
@@ -28,23 +38,32 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/unidoc/unipdf/v3/common"
 	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/core"
 	"github.com/unidoc/unipdf/v3/extractor"
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/pdfutil"
 )
 
-func init() {
+// InitLicense sets up the UniDoc metered license from UNIDOC_LICENSE_API_KEY. The key is read from
+// the environment, which .env is loaded into first if it exists. It must be called before
+// extractPDF. The returned error wraps errLicense.
+func InitLicense() error {
 	// Make sure to load your metered License API key prior to using the library.
 	// If you need a key, you can sign up and create a free one at https://cloud.unidoc.io
+	// .env is optional: in CI or a container the key is usually injected into the environment.
 	err := godotenv.Load()
-	if err != nil {
-		panic("Error loading .env file")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: error loading .env file: %v", errLicense, err)
 	}
 	apiKey := os.Getenv("UNIDOC_LICENSE_API_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("%w: UNIDOC_LICENSE_API_KEY is not set in the environment or .env", errLicense)
+	}
 	err = license.SetMeteredKey(apiKey)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("%w: %v", errLicense, err)
 	}
+	return nil
 }
 
 type Options struct {
@@ -57,6 +76,78 @@ type Options struct {
 	Debug     bool
 	Trace     bool
 	DoProfile bool
+	// MemProfile writes a heap profile to mem.profile at the end of the run.
+	MemProfile bool
+	// MergeRows merges table rows that continue a wrapped cell from the row above.
+	MergeRows bool
+	// CellJoin is the separator used when merging wrapped cells.
+	CellJoin string
+	// SummaryLevel is the describe() level written to a .summary.txt next to the CSVs. 0 disables it.
+	SummaryLevel int
+	// SkipUnchanged leaves existing CSV files alone when their content hash is unchanged.
+	SkipUnchanged bool
+	// Grep keeps only the tables with a cell containing this (normalized) keyword.
+	Grep string
+	// TitleInName adds a slug of the menu title found on the first page to the CSV file names.
+	TitleInName bool
+	// KeepEmpty writes every table the extractor finds, skipping the Width/Height filter.
+	KeepEmpty bool
+	// Strict makes extractPDF return errNoTables if no tables are extracted from any file.
+	Strict bool
+	// StartAt is the 1-offset index in the sorted file list to start extracting from.
+	StartAt int
+	// SourceURLs maps each input PDF path to the URL it was downloaded from.
+	SourceURLs map[string]string
+	// CSVRootFunc returns the path, without extension, that the CSV files for PDF `inPath` are
+	// named from. nil means defaultCSVRoot(CSVDir).
+	CSVRootFunc func(inPath string) (csvRoot string, err error)
+	// TracePage turns on trace logging for just this (1-offset) page and dumps the extractor's raw
+	// tables for it to <csvRoot>.page<n>.trace.txt. 0 disables it.
+	TracePage int
+	// MonthFromContent files each PDF's CSVs under the year and month found in its first page
+	// rather than the ones in its path, when the page has one.
+	MonthFromContent bool
+	// MaxPageBytes skips pages whose decoded content streams are larger than this many bytes. 0
+	// means no limit.
+	MaxPageBytes int
+	// The following are passed to the UniDoc extractor. All false is the extractor's defaults.
+	// ApplyCropBox extracts only the text inside each page's crop box, dropping printer marks or
+	// notes outside it that can otherwise be picked up as extra table cells.
+	ApplyCropBox bool
+	// IncludeAnnotations extracts the text of annotations, e.g. comments added to the PDF, too.
+	IncludeAnnotations bool
+	// DisableDocumentTags ignores the PDF's structure tags, which can be wrong in PDFs exported
+	// from spreadsheets and then split or merge tables.
+	DisableDocumentTags bool
+	// RunID identifies this run in the summary files.
+	RunID string
+	// MealsJSON parses the meals in each PDF's tables and writes them to <csvRoot>.meals.json.
+	MealsJSON bool
+	// JSONPretty indents the JSON files instead of writing them compact.
+	JSONPretty bool
+	// ClosedTokens are the meal cell texts that mean the cafeteria is closed, for MealsJSON and
+	// MealsDB. nil means the MealOptions default.
+	ClosedTokens []string
+	// RoundCalories rounds the meals' calories to the nearest 10 kcal instead of keeping the
+	// menus' figures.
+	RoundCalories bool
+	// DayTextDir is the directory to write a plaintext menu file for each day of the meals parsed
+	// from each PDF to, as by saveDayTexts. "" disables it.
+	DayTextDir string
+	// MealsDB is the path of a SQLite database to upsert the meals parsed from each PDF into. ""
+	// disables it.
+	MealsDB string
+	// Weeks writes a Markdown digest of the meals parsed from each PDF, a section for each week,
+	// to <csvRoot>.weeks.md.
+	Weeks bool
+	// WeekStart is the first day of the weeks of Weeks.
+	WeekStart time.Weekday
+	// WarningsCSV writes where the meals of each PDF couldn't be read for sure, as collected by
+	// ParseMeals, to <csvRoot>.warnings.csv for staff checking the month.
+	WarningsCSV bool
+	// CorrectionsFile is a JSON file of corrections, as read by loadCorrections, applied to the
+	// meals parsed from each PDF before they are written or stored. "" disables it.
+	CorrectionsFile string
 }
 
 type Option func(*Options)
@@ -115,18 +206,236 @@ func DoProfile(doProfile bool) Option {
 	}
 }
 
-func extractPDF(PDFFilePath []string, options ...Option) error {
+func MaxPageBytes(n int) Option {
+	return func(opts *Options) {
+		opts.MaxPageBytes = n
+	}
+}
+
+func ApplyCropBox(apply bool) Option {
+	return func(opts *Options) {
+		opts.ApplyCropBox = apply
+	}
+}
+
+func IncludeAnnotations(include bool) Option {
+	return func(opts *Options) {
+		opts.IncludeAnnotations = include
+	}
+}
+
+func DisableDocumentTags(disable bool) Option {
+	return func(opts *Options) {
+		opts.DisableDocumentTags = disable
+	}
+}
+
+func RunID(runID string) Option {
+	return func(opts *Options) {
+		opts.RunID = runID
+	}
+}
+
+func MemProfile(memProfile bool) Option {
+	return func(opts *Options) {
+		opts.MemProfile = memProfile
+	}
+}
+
+func MergeRows(mergeRows bool) Option {
+	return func(opts *Options) {
+		opts.MergeRows = mergeRows
+	}
+}
+
+func CellJoin(sep string) Option {
+	return func(opts *Options) {
+		opts.CellJoin = sep
+	}
+}
+
+func SummaryLevel(level int) Option {
+	return func(opts *Options) {
+		opts.SummaryLevel = level
+	}
+}
+
+func MealsJSON(write bool) Option {
+	return func(opts *Options) {
+		opts.MealsJSON = write
+	}
+}
+
+func JSONPretty(pretty bool) Option {
+	return func(opts *Options) {
+		opts.JSONPretty = pretty
+	}
+}
+
+func RoundCalories(round bool) Option {
+	return func(opts *Options) {
+		opts.RoundCalories = round
+	}
+}
+
+func ClosedTokens(tokens []string) Option {
+	return func(opts *Options) {
+		opts.ClosedTokens = tokens
+	}
+}
+
+func DayTextDir(dir string) Option {
+	return func(opts *Options) {
+		opts.DayTextDir = dir
+	}
+}
+
+func Weeks(weeks bool, weekStart time.Weekday) Option {
+	return func(opts *Options) {
+		opts.Weeks = weeks
+		opts.WeekStart = weekStart
+	}
+}
+
+func WarningsCSV(warnings bool) Option {
+	return func(opts *Options) {
+		opts.WarningsCSV = warnings
+	}
+}
+
+func CorrectionsFile(path string) Option {
+	return func(opts *Options) {
+		opts.CorrectionsFile = path
+	}
+}
+
+func MealsDB(path string) Option {
+	return func(opts *Options) {
+		opts.MealsDB = path
+	}
+}
+
+func SkipUnchanged(skip bool) Option {
+	return func(opts *Options) {
+		opts.SkipUnchanged = skip
+	}
+}
+
+func Grep(keyword string) Option {
+	return func(opts *Options) {
+		opts.Grep = keyword
+	}
+}
+
+func TitleInName(titleInName bool) Option {
+	return func(opts *Options) {
+		opts.TitleInName = titleInName
+	}
+}
+
+func KeepEmpty(keepEmpty bool) Option {
+	return func(opts *Options) {
+		opts.KeepEmpty = keepEmpty
+	}
+}
+
+func Strict(strict bool) Option {
+	return func(opts *Options) {
+		opts.Strict = strict
+	}
+}
+
+func StartAt(index int) Option {
+	return func(opts *Options) {
+		opts.StartAt = index
+	}
+}
+
+func SourceURLs(urls map[string]string) Option {
+	return func(opts *Options) {
+		opts.SourceURLs = urls
+	}
+}
+
+func CSVRootFunc(f func(inPath string) (csvRoot string, err error)) Option {
+	return func(opts *Options) {
+		opts.CSVRootFunc = f
+	}
+}
+
+func TracePage(page int) Option {
+	return func(opts *Options) {
+		opts.TracePage = page
+	}
+}
+
+func MonthFromContent(monthFromContent bool) Option {
+	return func(opts *Options) {
+		opts.MonthFromContent = monthFromContent
+	}
+}
+
+// defaultCSVRoot returns the default CSV layout: <csvDir>/<year dir>/<month>/<month>, where the
+// year dir and month are taken from the PDF's parent directory and base name, e.g.
+// PDF/2024PDF/apr.pdf -> <csvDir>/2024PDF/apr/apr.
+func defaultCSVRoot(csvDir string) func(inPath string) (string, error) {
+	return func(inPath string) (string, error) {
+		csvYearDirName, err := extractDirectory(inPath, -2)
+		if err != nil {
+			return "", fmt.Errorf("failed to extract year directory: %w", err)
+		}
+		csvMonthDirName, err := extractDirectory(inPath, -1)
+		if err != nil {
+			return "", fmt.Errorf("failed to extract month: %w", err)
+		}
+		csvSubDir := filepath.Join(csvDir, csvYearDirName, csvMonthDirName)
+		return changeDirExt(csvSubDir, filepath.Base(inPath), "", ""), nil
+	}
+}
+
+// extractPDF extracts the tables from the PDF files `PDFFilePath` as controlled by `options`. It
+// stops at the next page once `ctx` is done, leaving the files for earlier PDFs in place.
+func extractPDF(ctx context.Context, PDFFilePath []string, options ...Option) error {
 	// Default Options
 	opts := Options{
-		CSVDir:    "./outcsv",
-		FirstPage: -1,
-		LastPage:  10000,
-		Width:     0,
-		Height:    0,
-		Verbose:   1,
-		Debug:     false,
-		Trace:     false,
-		DoProfile: false,
+		CSVDir:              "./outcsv",
+		FirstPage:           -1,
+		LastPage:            10000,
+		Width:               0,
+		Height:              0,
+		Verbose:             1,
+		Debug:               false,
+		Trace:               false,
+		DoProfile:           false,
+		MemProfile:          false,
+		MergeRows:           false,
+		CellJoin:            " ",
+		SummaryLevel:        0,
+		SkipUnchanged:       false,
+		Grep:                "",
+		TitleInName:         false,
+		KeepEmpty:           false,
+		Strict:              false,
+		StartAt:             1,
+		SourceURLs:          nil,
+		CSVRootFunc:         nil,
+		TracePage:           0,
+		MonthFromContent:    false,
+		MaxPageBytes:        0,
+		ApplyCropBox:        false,
+		IncludeAnnotations:  false,
+		DisableDocumentTags: false,
+		RunID:               "",
+		MealsJSON:           false,
+		JSONPretty:          false,
+		MealsDB:             "",
+		ClosedTokens:        nil,
+		RoundCalories:       false,
+		DayTextDir:          "",
+		Weeks:               false,
+		WeekStart:           time.Monday,
+		WarningsCSV:         false,
+		CorrectionsFile:     "",
 	}
 
 	for _, option := range options {
@@ -134,20 +443,28 @@ func extractPDF(PDFFilePath []string, options ...Option) error {
 	}
 
 	if opts.Trace {
-		common.SetLogger(common.NewConsoleLogger(common.LogLevelTrace))
+		common.SetLogger(newUniDocLogger(common.LogLevelTrace))
 	} else if opts.Debug {
-		common.SetLogger(common.NewConsoleLogger(common.LogLevelDebug))
+		common.SetLogger(newUniDocLogger(common.LogLevelDebug))
 	} else {
-		common.SetLogger(common.NewConsoleLogger(common.LogLevelInfo))
+		common.SetLogger(newUniDocLogger(common.LogLevelInfo))
 	}
 
-	makeDir("CSV directory", opts.CSVDir)
+	if err := makeDirErr("CSV directory", opts.CSVDir); err != nil {
+		return err
+	}
+	if err := makeDirErr("day menu directory", opts.DayTextDir); err != nil {
+		return err
+	}
 
 	pathList, err := patternsToPaths(PDFFilePath)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("%d PDF files\n", len(pathList))
+	if len(pathList) > 0 && (opts.StartAt < 1 || opts.StartAt > len(pathList)) {
+		return fmt.Errorf("start at file %d out of range 1-%d", opts.StartAt, len(pathList))
+	}
 
 	if opts.DoProfile {
 		f, err := os.Create("cpu.profile")
@@ -160,39 +477,171 @@ func extractPDF(PDFFilePath []string, options ...Option) error {
 		}
 		defer pprof.StopCPUProfile()
 	}
+	if opts.MemProfile {
+		f, err := os.Create("mem.profile")
+		if err != nil {
+			return fmt.Errorf("could not create memory profile: err=%w", err)
+		}
+		defer f.Close()
+		defer func() {
+			runtime.GC() // get up-to-date statistics
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Printf("could not write memory profile: err=%v", err)
+			}
+		}()
+	}
 
+	var mealDB *MealDB
+	if opts.MealsDB != "" {
+		var err error
+		if mealDB, err = OpenMealDB(ctx, opts.MealsDB); err != nil {
+			return fmt.Errorf("could not open meal database: err=%w", err)
+		}
+		defer mealDB.Close()
+	}
+	var corrections mealCorrections
+	if opts.CorrectionsFile != "" {
+		var err error
+		if corrections, err = loadCorrections(opts.CorrectionsFile); err != nil {
+			return fmt.Errorf("could not load meal corrections: err=%w", err)
+		}
+	}
+
+	csvRootFunc := opts.CSVRootFunc
+	if csvRootFunc == nil {
+		csvRootFunc = defaultCSVRoot(opts.CSVDir)
+	}
+
+	pageOpts := opts.pageOptions()
+
+	// A bad file is logged and skipped so that it doesn't lose the work for the others. The errors
+	// are returned together at the end.
+	var fileErrs []error
+	fail := func(err error) {
+		log.Printf("Error: %v", err)
+		fileErrs = append(fileErrs, err)
+	}
+
+	numTables := 0
 	for i, inPath := range pathList {
+		if i+1 < opts.StartAt {
+			common.Log.Info("Skipping %d of %d: %q", i+1, len(pathList), inPath)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("stopped before %d of %d PDF files: %w", i+1, len(pathList), err)
+		}
 		t0 := time.Now()
-		result, err := extractTables(inPath, opts.FirstPage, opts.LastPage)
+		result, err := extractTables(ctx, inPath, opts.FirstPage, opts.LastPage, opts.TracePage, pageOpts)
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return fmt.Errorf("stopped in %d of %d PDF files: %w", i+1, len(pathList), err)
+		}
 		if err != nil {
-			log.Fatalf("Error: %v\n", err)
+			fail(err)
 			continue
 		}
+		result.sourceURL = opts.SourceURLs[inPath]
+		result.runID = opts.RunID
 		duration := time.Since(t0).Seconds()
 		numPages := len(result.pageTables)
-		result = result.filter(opts.Width, opts.Height)
+		result = result.applyOptions(opts)
+		sizeMB, err := fileSizeMB(inPath)
+		if err != nil {
+			log.Printf("warning: %v", err)
+		}
 		log.Printf("%3d of %d: %4.1f MB %3d pages %4.1f sec %q %s",
-			i+1, len(pathList), fileSizeMB(inPath), numPages, duration, inPath, result.describe(opts.Verbose))
-		csvYearDirName, err := extractDirectory(inPath, 1)
-		csvMonthDirName, err := extractDirectory(inPath, -1)
+			i+1, len(pathList), sizeMB, numPages, duration, inPath, result.describe(opts.Verbose))
+		csvRoot, err := resultCSVRoot(inPath, result, csvRootFunc, opts)
 		if err != nil {
-			log.Fatalf("Failed to extract directory: %v\n", err)
+			fail(fmt.Errorf("failed to compute CSV root for %q: %w", inPath, err))
+			continue
+		}
+		if err := makeDirErr("CSV Sub directory", filepath.Dir(csvRoot)); err != nil {
+			fail(err)
+			continue
+		}
+		if opts.TitleInName {
+			csvRoot = titledCSVRoot(csvRoot, result.title)
 		}
-		csvSubDir := opts.CSVDir + "/" + csvYearDirName + "/" + csvMonthDirName
-		makeDir("CSV Sub directory", csvSubDir)
-		csvRoot := changeDirExt(csvSubDir, filepath.Base(inPath), "", "")
 		fmt.Println(csvRoot)
-		if err := result.saveCSVFiles(csvRoot); err != nil {
-			log.Fatalf("Failed to write %q: %v\n", csvRoot, err)
+		if err := result.saveCSVFiles(csvRoot, opts.SkipUnchanged); err != nil {
+			fail(fmt.Errorf("failed to write %q: %w", csvRoot, err))
 			continue
 		}
+		numTables += result.numTables()
+		if result.trace != nil {
+			if err := result.trace.save(csvRoot); err != nil {
+				fail(fmt.Errorf("failed to write page trace for %q: %w", csvRoot, err))
+				continue
+			}
+		}
+		if opts.SummaryLevel > 0 {
+			if err := result.saveSummary(csvRoot, opts.SummaryLevel); err != nil {
+				fail(fmt.Errorf("failed to write summary for %q: %w", csvRoot, err))
+				continue
+			}
+		}
+		if opts.MealsJSON || mealDB != nil || opts.DayTextDir != "" || opts.Weeks || opts.WarningsCSV {
+			// The first page may give no month, or a month without a year; the path has both.
+			if pathYear, pathMon := pathMonth(inPath); result.month == 0 {
+				result.year, result.month = pathYear, pathMon
+			} else if result.year == 0 {
+				result.year = pathYear
+			}
+			meals, warnings, err := ParseMeals(result, MealOptions{
+				ClosedTokens:  opts.ClosedTokens,
+				RoundCalories: opts.RoundCalories,
+			})
+			if err != nil {
+				log.Printf("warning: %s: no meals saved: %v", csvRoot, err)
+				continue
+			}
+			meals = corrections.apply(meals)
+			if opts.WarningsCSV {
+				if err := saveWarnings(csvRoot, warnings); err != nil {
+					fail(fmt.Errorf("failed to write parse warnings for %q: %w", csvRoot, err))
+					continue
+				}
+			}
+			if opts.MealsJSON {
+				if err := saveMeals(csvRoot, meals, opts.JSONPretty); err != nil {
+					fail(fmt.Errorf("failed to write meals for %q: %w", csvRoot, err))
+					continue
+				}
+			}
+			if mealDB != nil {
+				if err := mealDB.UpsertMeals(ctx, meals); err != nil {
+					fail(fmt.Errorf("failed to store meals for %q: %w", csvRoot, err))
+					continue
+				}
+			}
+			if opts.DayTextDir != "" {
+				if err := saveDayTexts(opts.DayTextDir, meals); err != nil {
+					fail(fmt.Errorf("failed to write day menus for %q: %w", csvRoot, err))
+					continue
+				}
+			}
+			if opts.Weeks {
+				if err := saveWeeks(csvRoot, meals, opts.WeekStart); err != nil {
+					fail(fmt.Errorf("failed to write weekly menus for %q: %w", csvRoot, err))
+					continue
+				}
+			}
+		}
 	}
 
+	if len(fileErrs) > 0 {
+		return fmt.Errorf("%d of %d PDF files failed: %w", len(fileErrs), len(pathList), errors.Join(fileErrs...))
+	}
+	if opts.Strict && numTables == 0 {
+		return fmt.Errorf("%w from %d PDF files", errNoTables, len(pathList))
+	}
 	return nil
 }
 
-// extractTables extracts tables from pages `firstPage` to `lastPage` in PDF file `inPath`.
-func extractTables(inPath string, firstPage, lastPage int) (docTables, error) {
+// extractTables extracts tables from pages `firstPage` to `lastPage` in PDF file `inPath`, as
+// extractPages does with `tracePage` and `ctx`. Each page is extracted with `pageOpts`.
+func extractTables(ctx context.Context, inPath string, firstPage, lastPage, tracePage int, pageOpts pageOptions) (docTables, error) {
 	f, err := os.Open(inPath)
 	if err != nil {
 		return docTables{}, fmt.Errorf("Could not open %q err=%w", inPath, err)
@@ -215,66 +664,452 @@ func extractTables(inPath string, firstPage, lastPage int) (docTables, error) {
 		lastPage = numPages
 	}
 
-	result := docTables{pageTables: make(map[int][]stringTable)}
+	return extractPages(ctx, inPath, firstPage, lastPage, tracePage, func(pageNum int) (pageExtract, error) {
+		return extractPageTables(pdfReader, pageNum, pageOpts)
+	})
+}
+
+// extractPages returns the tables that `extractPage` extracts from pages `firstPage` to `lastPage`
+// of PDF file `inPath`, with the title and month from the first page and the footnote legend from
+// all of them, the first page to define a mark winning. Page `tracePage` is
+// extracted with trace logging, and its raw tables are kept in the result's trace. It stops before
+// the next page once `ctx` is done.
+func extractPages(ctx context.Context, inPath string, firstPage, lastPage, tracePage int, extractPage func(pageNum int) (pageExtract, error)) (docTables, error) {
+	result := docTables{
+		pageTables: make(map[int][]stringTable),
+		lineTables: make(map[int][]stringTable),
+		footnotes:  make(map[string]string),
+	}
+	prevBottomEdge := false
 	for pageNum := firstPage; pageNum <= lastPage; pageNum++ {
-		tables, err := extractPageTables(pdfReader, pageNum)
+		if err := ctx.Err(); err != nil {
+			return docTables{}, fmt.Errorf("stopped before page %d of %q: %w", pageNum, inPath, err)
+		}
+		var extracted pageExtract
+		var err error
+		if pageNum == tracePage {
+			logger := common.Log
+			common.SetLogger(newUniDocLogger(common.LogLevelTrace))
+			extracted, err = extractPage(pageNum)
+			common.SetLogger(logger)
+			if err == nil {
+				result.trace = &pageTrace{pageNum: pageNum, tables: extracted.raw}
+			}
+		} else {
+			extracted, err = extractPage(pageNum)
+		}
 		if err != nil {
 			return docTables{}, fmt.Errorf("extractPageTables failed. inPath=%q pageNum=%d err=%w",
 				inPath, pageNum, err)
 		}
-		result.pageTables[pageNum] = tables
+		result.pageTables[pageNum] = extracted.tables
+		result.lineTables[pageNum] = extracted.lineTables
+		if pageNum == firstPage {
+			result.title = menuTitle(extracted.text)
+			result.year, result.month, _ = menuMonth(extracted.text)
+		}
+		for mark, note := range parseFootnotes(extracted.text) {
+			if _, ok := result.footnotes[mark]; !ok {
+				result.footnotes[mark] = note
+			}
+		}
+		if prevBottomEdge && extracted.topEdge {
+			common.Log.Info("%q: last table on page %d reaches the page edge and may be cut off; "+
+				"its last row may be truncated and continue in the first table on page %d",
+				inPath, pageNum-1, pageNum)
+			result.continuedPages = append(result.continuedPages, pageNum-1)
+		}
+		prevBottomEdge = extracted.bottomEdge
 	}
 	return result, nil
 }
 
-// extractPageTables extracts the tables from (1-offset) page number `pageNum` in opened
-// PdfReader `pdfReader.
-func extractPageTables(pdfReader *model.PdfReader, pageNum int) ([]stringTable, error) {
+// resultCSVRoot returns the CSV root that the tables `result` extracted from PDF `inPath` are
+// written to: the one returned by `csvRootFunc` or, with opts.MonthFromContent, the one for the
+// year and month found on its first page.
+func resultCSVRoot(inPath string, result docTables, csvRootFunc func(string) (string, error), opts Options) (string, error) {
+	csvRoot, err := csvRootFunc(inPath)
+	if err != nil {
+		return "", err
+	}
+	if !opts.MonthFromContent || result.month == 0 {
+		return csvRoot, nil
+	}
+	contentRoot, err := contentCSVRoot(opts.CSVDir, inPath, result.year, result.month)
+	if err != nil {
+		return "", err
+	}
+	if contentRoot != csvRoot {
+		common.Log.Info("%q: page says %d/%02d, writing %q instead of %q",
+			inPath, result.year, result.month, contentRoot, csvRoot)
+	}
+	return contentRoot, nil
+}
+
+// pageExtract is what extractPageTables finds on a page.
+type pageExtract struct {
+	tables     []stringTable
+	lineTables []stringTable         // tables with cell line breaks kept, see asLineTable
+	raw        []extractor.TextTable // tables as returned by the extractor, in the same order
+	text       string
+	// topEdge and bottomEdge are true when the top-most or bottom-most table reaches the top or
+	// bottom page margin, suggesting a table that continues from the previous page or onto the next.
+	topEdge, bottomEdge bool
+}
+
+// pageOptions controls how extractPageTables extracts each page.
+type pageOptions struct {
+	// maxPageBytes > 0 skips, with a warning, pages whose content streams are larger than this,
+	// since the extractor's memory use grows with the content size.
+	maxPageBytes int
+	// extractor is passed to the UniDoc extractor. nil means its defaults.
+	extractor *extractor.Options
+}
+
+// pageOptions returns the pageOptions for extracting each page as `opts` controls.
+func (opts Options) pageOptions() pageOptions {
+	pageOpts := pageOptions{maxPageBytes: opts.MaxPageBytes}
+	if opts.ApplyCropBox || opts.IncludeAnnotations || opts.DisableDocumentTags {
+		pageOpts.extractor = &extractor.Options{
+			ApplyCropBox:        opts.ApplyCropBox,
+			IncludeAnnotations:  opts.IncludeAnnotations,
+			DisableDocumentTags: opts.DisableDocumentTags,
+		}
+	}
+	return pageOpts
+}
+
+// newExtractor returns the UniDoc extractor for a page. It is a variable so that it can be replaced
+// by a stub.
+var newExtractor = extractor.NewWithOptions
+
+// edgeMarginFraction is the fraction of the page height treated as the top and bottom margins when
+// looking for tables cut off at a page edge.
+const edgeMarginFraction = 0.05
+
+// extractPageTables extracts the tables and text from (1-offset) page number `pageNum` in opened
+// PdfReader `pdfReader`, as controlled by `pageOpts`.
+func extractPageTables(pdfReader *model.PdfReader, pageNum int, pageOpts pageOptions) (pageExtract, error) {
 	page, err := pdfReader.GetPage(pageNum)
 	if err != nil {
-		return nil, err
+		return pageExtract{}, err
 	}
+	return extractTablesFromPage(page, pageNum, pageOpts)
+}
+
+// extractTablesFromPage extracts the tables and text from `page`, page number `pageNum` of its
+// PDF, as controlled by `pageOpts`.
+func extractTablesFromPage(page *model.PdfPage, pageNum int, pageOpts pageOptions) (pageExtract, error) {
+	if pageOpts.maxPageBytes > 0 {
+		n, err := contentStreamBytes(page, pageOpts.maxPageBytes)
+		if err != nil {
+			log.Printf("warning: page %d: could not measure its content, extracting it anyway: %v", pageNum, err)
+		} else if n > pageOpts.maxPageBytes {
+			log.Printf("warning: skipping page %d: its content is over the %d byte -max-page-bytes limit",
+				pageNum, pageOpts.maxPageBytes)
+			return pageExtract{}, nil
+		}
+	}
+	// NormalizePage bakes any /Rotate into the page geometry so that rotated pages are extracted
+	// the right way up. Check that it did, since tables from a still-rotated page are garbage.
+	rotate := pageRotation(page)
 	if err := pdfutil.NormalizePage(page); err != nil {
-		return nil, err
+		return pageExtract{}, err
+	}
+	if rotate != 0 {
+		if after := pageRotation(page); after != 0 {
+			common.Log.Info("Skipping page %d: still rotated %d degrees after normalization (was %d)",
+				pageNum, after, rotate)
+			return pageExtract{}, nil
+		}
+		common.Log.Info("Page %d: normalized /Rotate %d before extraction", pageNum, rotate)
 	}
 
-	ex, err := extractor.New(page)
+	ex, err := newExtractor(page, pageOpts.extractor)
 	if err != nil {
-		return nil, err
+		return pageExtract{}, err
 	}
 	pageText, _, _, err := ex.ExtractPageText()
 	if err != nil {
-		return nil, err
+		return pageExtract{}, err
 	}
 	tables := pageText.Tables()
+	sortTablesByPosition(tables)
 	stringTables := make([]stringTable, len(tables))
+	lineTables := make([]stringTable, len(tables))
 	for i, table := range tables {
 		stringTables[i] = asStringTable(table)
+		lineTables[i] = asLineTable(table)
+	}
+	extracted := pageExtract{tables: stringTables, lineTables: lineTables, raw: tables, text: pageText.Text()}
+	if mediaBox, err := page.GetMediaBox(); err == nil {
+		extracted.topEdge, extracted.bottomEdge = tableEdges(tables, *mediaBox)
+	}
+	return extracted, nil
+}
+
+// tableEdges returns whether the first of `tables`, sorted by sortTablesByPosition, reaches the
+// top margin of page `mediaBox` and whether the last reaches the bottom margin.
+func tableEdges(tables []extractor.TextTable, mediaBox model.PdfRectangle) (topEdge, bottomEdge bool) {
+	if len(tables) == 0 {
+		return false, false
+	}
+	margin := edgeMarginFraction * mediaBox.Height()
+	_, top := tableOrigin(tables[0])
+	return top >= mediaBox.Ury-margin, tableBottom(tables[len(tables)-1]) <= mediaBox.Lly+margin
+}
+
+// tablePositionTolerance is how far apart, in points, the tops of two tables side by side can be
+// for sortTablesByPosition to treat them as level. The extractor's coordinates for tables that
+// are level on the page differ by rounding errors.
+const tablePositionTolerance = 1.0
+
+// sortTablesByPosition sorts `tables` top-to-bottom then left-to-right so that table numbering
+// doesn't depend on the order the extractor happens to return them in. Tables whose tops are
+// within tablePositionTolerance are sorted left-to-right.
+func sortTablesByPosition(tables []extractor.TextTable) {
+	sort.SliceStable(tables, func(i, j int) bool {
+		xi, yi := tableOrigin(tables[i])
+		xj, yj := tableOrigin(tables[j])
+		if math.Abs(yi-yj) > tablePositionTolerance {
+			// PDF y coordinates increase upwards so the top-most table has the largest y.
+			return yi > yj
+		}
+		return xi < xj
+	})
+}
+
+// tableOrigin returns the left-most x and top-most y of the cells in `table`.
+func tableOrigin(table extractor.TextTable) (float64, float64) {
+	x, y := math.Inf(1), math.Inf(-1)
+	for _, row := range table.Cells {
+		for _, cell := range row {
+			x = math.Min(x, cell.Llx)
+			y = math.Max(y, cell.Ury)
+		}
+	}
+	if math.IsInf(x, 0) {
+		return table.Llx, table.Ury
+	}
+	return x, y
+}
+
+// contentStreamBytes returns the decoded length of the content streams of `page`, counting no
+// further than one byte past `limit` so that a small stream that inflates to gigabytes is never
+// held in memory. Flate streams, the usual case, are inflated incrementally; streams with other
+// filters are decoded whole.
+func contentStreamBytes(page *model.PdfPage, limit int) (int, error) {
+	n := 0
+	for _, obj := range page.GetContentStreamObjs() {
+		stream, ok := core.GetStream(obj)
+		if !ok {
+			continue
+		}
+		size, err := decodedStreamBytes(stream, int64(limit-n)+1)
+		if err != nil {
+			return 0, fmt.Errorf("could not decode content stream: %w", err)
+		}
+		if n += int(size); n > limit {
+			break
+		}
+	}
+	return n, nil
+}
+
+// decodedStreamBytes returns the decoded length of `stream`, or `max` if it is at least that long.
+func decodedStreamBytes(stream *core.PdfObjectStream, max int64) (int64, error) {
+	encoder, err := core.NewEncoderFromStream(stream)
+	if err != nil {
+		return 0, err
+	}
+	switch encoder.(type) {
+	case *core.RawEncoder:
+		return min(int64(len(stream.Stream)), max), nil
+	case *core.FlateEncoder:
+		// Any predictor only shrinks the inflated data, so this is an upper bound.
+		r, err := zlib.NewReader(bytes.NewReader(stream.Stream))
+		if err != nil {
+			return 0, err
+		}
+		defer r.Close()
+		return io.Copy(io.Discard, io.LimitReader(r, max))
+	}
+	decoded, err := core.DecodeStream(stream)
+	if err != nil {
+		return 0, err
+	}
+	return min(int64(len(decoded)), max), nil
+}
+
+// pageRotation returns the /Rotate of `page`, inherited or its own, in degrees from 0 to 359, or 0
+// if it can't be read.
+func pageRotation(page *model.PdfPage) int64 {
+	rotate, err := page.GetRotate()
+	if err != nil {
+		return 0
+	}
+	return (rotate%360 + 360) % 360
+}
+
+// tableBottom returns the bottom-most y of the cells in `table`.
+func tableBottom(table extractor.TextTable) float64 {
+	y := math.Inf(1)
+	for _, row := range table.Cells {
+		for _, cell := range row {
+			y = math.Min(y, cell.Lly)
+		}
+	}
+	if math.IsInf(y, 0) {
+		return table.Lly
 	}
-	return stringTables, nil
+	return y
 }
 
 // docTables describes the tables in a document.
 type docTables struct {
 	pageTables map[int][]stringTable
+	// lineTables are all the tables on each page, unfiltered, with the line breaks inside cells
+	// kept, for ParseMeals. nil if the tables didn't come from a PDF.
+	lineTables map[int][]stringTable
+	title      string     // menu title found on the first page, if any
+	sourceURL  string     // URL the PDF was downloaded from, if known
+	runID      string     // ID of the run that extracted the tables, if known
+	year       int        // year found on the first page, 0 if none
+	month      time.Month // month found on the first page, 0 if none
+	// footnotes is the legend of the footnote marks, e.g. "※1", found in the text of the pages,
+	// as for parseFootnotes. nil if the tables didn't come from a PDF.
+	footnotes map[string]string
+	// continuedPages are the pages whose last table looks cut off at the bottom edge and
+	// continued at the top of the next page.
+	continuedPages []int
+	trace          *pageTrace // raw tables of the Options.TracePage page, if it was extracted
+}
+
+// pageTrace is the extractor's raw tables for one page, kept for debugging.
+type pageTrace struct {
+	pageNum int
+	tables  []extractor.TextTable
+}
+
+// save writes the trace to <csvRoot>.page<n>.trace.txt.
+func (pt *pageTrace) save(csvRoot string) error {
+	tracePath := fmt.Sprintf("%s.page%d.trace.txt", csvRoot, pt.pageNum)
+	b := new(bytes.Buffer)
+	pt.write(b)
+	if err := ioutil.WriteFile(tracePath, b.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write tracePath=%q err=%w", tracePath, err)
+	}
+	return nil
+}
+
+// write writes the bounding box, size and cells of each table in `pt` to `w`. Each cell is
+// written with its row, column, bounding box and text.
+func (pt *pageTrace) write(w io.Writer) {
+	fmt.Fprintf(w, "page %d: %d tables\n", pt.pageNum, len(pt.tables))
+	for i, table := range pt.tables {
+		fmt.Fprintf(w, "table %d: %dx%d bbox=(%.2f %.2f %.2f %.2f)\n",
+			i+1, table.W, table.H, table.Llx, table.Lly, table.Urx, table.Ury)
+		for y, row := range table.Cells {
+			for x, cell := range row {
+				fmt.Fprintf(w, "  [%d,%d] (%.2f %.2f %.2f %.2f) %q\n",
+					y, x, cell.Llx, cell.Lly, cell.Urx, cell.Ury, cell.Text)
+			}
+		}
+	}
+}
+
+// emptyCopy returns a docTables with the same metadata as `r` but no tables.
+func (r docTables) emptyCopy() docTables {
+	c := r
+	c.pageTables = make(map[int][]stringTable)
+	return c
 }
 
 // stringTable is the strings in TextTable.
 type stringTable [][]string
 
-func (r docTables) saveCSVFiles(csvRoot string) error {
+// saveCSVFiles writes each table in `r` to <csvRoot>.page<n>.table<m>.csv. If `skipUnchanged` is
+// true, files that already exist with the same content hash are not rewritten.
+func (r docTables) saveCSVFiles(csvRoot string, skipUnchanged bool) error {
+	skipped := 0
+	csvPaths := r.csvPaths(csvRoot)
+	for i, table := range r.tables() {
+		csvPath := csvPaths[i]
+		contents := table.csv()
+		if skipUnchanged && sameContentHash(csvPath, []byte(contents)) {
+			skipped++
+			continue
+		}
+		if err := ioutil.WriteFile(csvPath, []byte(contents), 0666); err != nil {
+			return fmt.Errorf("failed to write csvPath=%q err=%w", csvPath, err)
+		}
+	}
+	if skipped > 0 {
+		common.Log.Info("saveCSVFiles: %d unchanged CSV files skipped for %q", skipped, csvRoot)
+	}
+	return nil
+}
+
+// csvPaths returns the paths of the CSV files saveCSVFiles(`csvRoot`) writes, in the same order as
+// tables().
+func (r docTables) csvPaths(csvRoot string) []string {
+	var paths []string
 	for _, pageNum := range r.pageNumbers() {
-		for i, table := range r.pageTables[pageNum] {
-			csvPath := fmt.Sprintf("%s.page%d.table%d.csv", csvRoot, pageNum, i+1)
-			contents := table.csv()
-			if err := ioutil.WriteFile(csvPath, []byte(contents), 0666); err != nil {
-				return fmt.Errorf("failed to write csvPath=%q err=%w", csvPath, err)
-			}
+		for i := range r.pageTables[pageNum] {
+			paths = append(paths, fmt.Sprintf("%s.page%d.table%d.csv", csvRoot, pageNum, i+1))
 		}
 	}
+	return paths
+}
+
+// tables returns the tables in `r` ordered by page number then table number.
+func (r docTables) tables() []stringTable {
+	var tables []stringTable
+	for _, pageNum := range r.pageNumbers() {
+		tables = append(tables, r.pageTables[pageNum]...)
+	}
+	return tables
+}
+
+// sameContentHash returns true if file `filename` exists and has the same SHA-256 as `contents`.
+func sameContentHash(filename string, contents []byte) bool {
+	existing, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(existing) == sha256.Sum256(contents)
+}
+
+// saveSummary writes describe(`level`) for `r` to <csvRoot>.summary.txt.
+func (r docTables) saveSummary(csvRoot string, level int) error {
+	summaryPath := csvRoot + ".summary.txt"
+	b := new(bytes.Buffer)
+	if err := WriteSummary(b, r, level); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(summaryPath, b.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write summaryPath=%q err=%w", summaryPath, err)
+	}
 	return nil
 }
 
+// WriteSummary writes describe(`level`) for `r` to `w`, preceded by the source URL and run ID if
+// known.
+func WriteSummary(w io.Writer, r docTables, level int) error {
+	if r.sourceURL != "" {
+		if _, err := fmt.Fprintf(w, "source: %s\n", r.sourceURL); err != nil {
+			return err
+		}
+	}
+	if r.runID != "" {
+		if _, err := fmt.Fprintf(w, "run: %s\n", r.runID); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, r.describe(level))
+	return err
+}
+
 // wh returns the width and height of table `t`.
 func (t stringTable) wh() (int, int) {
 	if len(t) == 0 {
@@ -283,20 +1118,84 @@ func (t stringTable) wh() (int, int) {
 	return len(t[0]), len(t)
 }
 
+// padded returns `t` with every row padded with empty cells to the width of its widest row. `t`
+// itself is returned if it is already rectangular.
+func (t stringTable) padded() stringTable {
+	width, height := t.wh()
+	ragged := false
+	for _, row := range t {
+		if len(row) != width {
+			ragged = true
+		}
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if !ragged {
+		return t
+	}
+	common.Log.Debug("padding ragged table to %d x %d", width, height)
+	padded := make(stringTable, height)
+	for y, row := range t {
+		if len(row) < width {
+			common.Log.Debug("row[%d]: padding %d cells to %d", y, len(row), width)
+			row = append(append([]string(nil), row...), make([]string, width-len(row))...)
+		}
+		padded[y] = row
+	}
+	return padded
+}
+
 // csv returns `t` in CSV format.
 func (t stringTable) csv() string {
-	w, h := t.wh()
 	b := new(bytes.Buffer)
-	csvwriter := csv.NewWriter(b)
-	for y, row := range t {
-		if len(row) != w {
-			err := fmt.Errorf("table = %d x %d row[%d]=%d %q", w, h, y, len(row), row)
-			panic(err)
+	if err := WriteCSV(b, t); err != nil {
+		panic(err)
+	}
+	return b.String()
+}
+
+// WriteCSV writes `t` to `w` in CSV format. Ragged rows are padded with empty cells to the width
+// of the widest row, so that the CSV is rectangular and no cells are lost.
+func WriteCSV(w io.Writer, t stringTable) error {
+	t = t.padded()
+	// csv.NewWriter reuses bw as its buffer, so rows written directly to bw by the fast path stay
+	// in order with the ones written by csvwriter.
+	bw := bufio.NewWriter(w)
+	csvwriter := csv.NewWriter(bw)
+	for _, row := range t {
+		if plainCSVRow(row) {
+			bw.WriteString(strings.Join(row, ","))
+			bw.WriteByte('\n')
+			continue
+		}
+		if err := csvwriter.Write(row); err != nil {
+			return err
 		}
-		csvwriter.Write(row)
 	}
 	csvwriter.Flush()
-	return b.String()
+	return csvwriter.Error()
+}
+
+// plainCSVRow returns true if no field in `row` needs quoting in CSV, so the row can be written as
+// the fields joined by commas. Only ASCII fields are checked; any other byte sends the row to
+// encoding/csv.
+func plainCSVRow(row []string) bool {
+	for _, field := range row {
+		if field == `\.` {
+			return false
+		}
+		for i := 0; i < len(field); i++ {
+			c := field[i]
+			if c >= utf8.RuneSelf || c == ',' || c == '"' || c == '\r' || c == '\n' {
+				return false
+			}
+		}
+		if len(field) > 0 && (field[0] == ' ' || field[0] == '\t' || field[0] == '\v' || field[0] == '\f') {
+			return false
+		}
+	}
+	return true
 }
 
 func (r *docTables) String() string {
@@ -326,6 +1225,9 @@ func (r *docTables) describe(level int) string {
 			continue
 		}
 		fmt.Fprintf(&sb, "   page %d: %d tables\n", pageNum, len(tables))
+		if r.continuesOnNextPage(pageNum) {
+			fmt.Fprintf(&sb, "      last table may be cut off and continue on page %d\n", pageNum+1)
+		}
 		if level <= 2 {
 			continue
 		}
@@ -349,6 +1251,17 @@ func (r *docTables) describe(level int) string {
 	return sb.String()
 }
 
+// continuesOnNextPage returns true if the last table on page `pageNum` looks like it continues on
+// the next page.
+func (r *docTables) continuesOnNextPage(pageNum int) bool {
+	for _, p := range r.continuedPages {
+		if p == pageNum {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *docTables) pageNumbers() []int {
 	pageNums := make([]int, len(r.pageTables))
 	i := 0
@@ -368,13 +1281,29 @@ func (r *docTables) numTables() int {
 	return n
 }
 
+// applyOptions returns `r` with the table filters and repairs in `opts` applied: the Width/Height
+// filter unless opts.KeepEmpty, then opts.Grep and opts.MergeRows.
+func (r docTables) applyOptions(opts Options) docTables {
+	if !opts.KeepEmpty {
+		r = r.filter(opts.Width, opts.Height)
+	}
+	if opts.Grep != "" {
+		r = r.grep(opts.Grep)
+	}
+	if opts.MergeRows {
+		r = r.mergeWrappedRows(opts.CellJoin)
+	}
+	return r
+}
+
 // filter returns the tables in `r` that are at least `width` cells wide and `height` cells high.
 func (r docTables) filter(width, height int) docTables {
-	filtered := docTables{pageTables: make(map[int][]stringTable)}
+	filtered := r.emptyCopy()
 	for pageNum, tables := range r.pageTables {
 		var filteredTables []stringTable
 		for _, table := range tables {
-			if len(table[0]) >= width && len(table) >= height {
+			// wh() is 0, 0 for a table with no rows, so those are dropped by positive thresholds.
+			if w, h := table.wh(); w >= width && h >= height {
 				filteredTables = append(filteredTables, table)
 			}
 		}
@@ -385,6 +1314,91 @@ func (r docTables) filter(width, height int) docTables {
 	return filtered
 }
 
+// grep returns the tables in `r` that have a cell containing `keyword` after normalization.
+func (r docTables) grep(keyword string) docTables {
+	keyword = normalize(keyword)
+	filtered := r.emptyCopy()
+	for pageNum, tables := range r.pageTables {
+		var filteredTables []stringTable
+		for _, table := range tables {
+			if table.contains(keyword) {
+				filteredTables = append(filteredTables, table)
+			}
+		}
+		if len(filteredTables) > 0 {
+			filtered.pageTables[pageNum] = filteredTables
+		}
+	}
+	return filtered
+}
+
+// contains returns true if any cell of `t` contains `s`.
+func (t stringTable) contains(s string) bool {
+	for _, row := range t {
+		for _, cell := range row {
+			if strings.Contains(cell, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeWrappedRows returns the tables in `r` with stringTable.mergeWrappedRows(sep) applied.
+func (r docTables) mergeWrappedRows(sep string) docTables {
+	merged := r.emptyCopy()
+	for pageNum, tables := range r.pageTables {
+		mergedTables := make([]stringTable, len(tables))
+		for i, table := range tables {
+			mergedTables[i] = table.mergeWrappedRows(sep)
+		}
+		merged.pageTables[pageNum] = mergedTables
+	}
+	return merged
+}
+
+// mergeWrappedRows returns `t` with rows that continue a wrapped entry folded into the row above.
+// A row is taken to be a continuation when its first (label) cell is empty and the row above it
+// has a label, so a header row with an empty corner cell doesn't take in the rows after it. The
+// continuation row's non-empty cells are appended to the corresponding cells of the row above,
+// joined by `sep`. Rows that are entirely empty are dropped.
+func (t stringTable) mergeWrappedRows(sep string) stringTable {
+	var merged stringTable
+	labelled := false // the last row of merged has a label
+	for _, row := range t {
+		if isEmptyRow(row) {
+			continue
+		}
+		if row[0] != "" || !labelled {
+			merged = append(merged, append([]string(nil), row...))
+			labelled = row[0] != ""
+			continue
+		}
+		last := merged[len(merged)-1]
+		for x, cell := range row {
+			if cell == "" || x >= len(last) {
+				continue
+			}
+			if last[x] == "" {
+				last[x] = cell
+			} else {
+				last[x] += sep + cell
+			}
+		}
+	}
+	return merged
+}
+
+// isEmptyRow returns true if every cell of `row` is empty.
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
 // asStringTable returns TextTable `table` as a stringTable.
 func asStringTable(table extractor.TextTable) stringTable {
 	cells := make(stringTable, table.H)
@@ -397,6 +1411,31 @@ func asStringTable(table extractor.TextTable) stringTable {
 	return normalizeTable(cells)
 }
 
+// asLineTable returns TextTable `table` as a stringTable whose cells have each line normalized
+// separately, so that the line breaks that separate the dishes in a menu cell are kept. Blank
+// lines are dropped.
+func asLineTable(table extractor.TextTable) stringTable {
+	cells := make(stringTable, table.H)
+	for y, row := range table.Cells {
+		cells[y] = make([]string, table.W)
+		for x, cell := range row {
+			cells[y][x] = normalizeLines(cell.Text)
+		}
+	}
+	return cells
+}
+
+// normalizeLines returns `text` with each line normalized and blank lines dropped.
+func normalizeLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = normalize(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // normalizeTable returns `cells` with each cell normalized.
 func normalizeTable(cells stringTable) stringTable {
 	for y, row := range cells {
@@ -409,9 +1448,24 @@ func normalizeTable(cells stringTable) stringTable {
 
 // normalize returns a version of `text` that is NFKC normalized and has reduceSpaces() applied.
 func normalize(text string) string {
+	if plainASCII(text) {
+		return text
+	}
 	return reduceSpaces(norm.NFKC.String(text))
 }
 
+// plainASCII returns true if `text` is printable ASCII with no leading, trailing or repeated
+// spaces. NFKC and reduceSpaces() leave such text unchanged.
+func plainASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c < ' ' || c > '~' || (c == ' ' && (i == 0 || i == len(text)-1 || text[i-1] == ' ')) {
+			return false
+		}
+	}
+	return true
+}
+
 // reduceSpaces returns `text` with runs of spaces of any kind (spaces, tabs, line breaks, etc)
 // reduced to a single space.
 func reduceSpaces(text string) string {
@@ -421,6 +1475,41 @@ func reduceSpaces(text string) string {
 
 var reSpace = regexp.MustCompile(`(?m)\s+`)
 
+// menuTitle returns the first line of `text` that looks like a menu title (contains 献立), or "" if
+// there is none.
+func menuTitle(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = normalize(line)
+		if strings.Contains(line, "献立") {
+			return line
+		}
+	}
+	return ""
+}
+
+// titledCSVRoot returns `csvRoot` with the slugified menu `title` appended, or just `csvRoot`, named
+// from the PDF's base name, if there is no usable title.
+func titledCSVRoot(csvRoot, title string) string {
+	if slug := slugify(title); slug != "" {
+		return csvRoot + "." + slug
+	}
+	return csvRoot
+}
+
+// slugify returns `title` made safe for use in a file name: runs of spaces and path or shell
+// special characters are replaced by "_" and the result is limited to maxSlugRunes runes.
+func slugify(title string) string {
+	slug := strings.Trim(reSlugUnsafe.ReplaceAllString(normalize(title), "_"), "_")
+	if runes := []rune(slug); len(runes) > maxSlugRunes {
+		slug = strings.TrimRight(string(runes[:maxSlugRunes]), "_")
+	}
+	return slug
+}
+
+const maxSlugRunes = 40
+
+var reSlugUnsafe = regexp.MustCompile(`[\s/\\:*?"<>|.]+`)
+
 // patternsToPaths returns the file paths matched by the patterns in `patternList`.
 func patternsToPaths(patternList []string) ([]string, error) {
 	var pathList []string
@@ -474,12 +1563,12 @@ func regularFile(filename string) (bool, error) {
 }
 
 // fileSizeMB returns the size of file `filename` in megabytes.
-func fileSizeMB(filename string) float64 {
+func fileSizeMB(filename string) (float64, error) {
 	fi, err := os.Stat(filename)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	return float64(fi.Size()) / 1024.0 / 1024.0
+	return float64(fi.Size()) / 1024.0 / 1024.0, nil
 }
 
 // makeUsage updates flag.Usage to include usage message `msg`.
@@ -491,22 +1580,23 @@ func makeUsage(msg string) {
 	}
 }
 
-// makeDir creates `outDir`. Name is the name of `outDir` in the calling code.
-func makeDir(name, outDir string) {
+// makeDirErr creates `outDir`. Name is the name of `outDir` in the calling code.
+func makeDirErr(name, outDir string) error {
 	if outDir == "." || outDir == ".." {
-		panic(fmt.Errorf("%s=%q not allowed", name, outDir))
+		return fmt.Errorf("%s=%q not allowed", name, outDir)
 	}
 	if outDir == "" {
-		return
+		return nil
 	}
 
 	outDir, err := filepath.Abs(outDir)
 	if err != nil {
-		panic(fmt.Errorf("Abs failed. %s=%q err=%w", name, outDir, err))
+		return fmt.Errorf("Abs failed. %s=%q err=%w", name, outDir, err)
 	}
 	if err := os.MkdirAll(outDir, 0751); err != nil {
-		panic(fmt.Errorf("Couldn't create %s=%q err=%w", name, outDir, err))
+		return fmt.Errorf("Couldn't create %s=%q err=%w", name, outDir, err)
 	}
+	return nil
 }
 
 // changeDirExt inserts `qualifier` into `filename` before its extension then changes its
@@ -527,16 +1617,17 @@ func changeDirExt(dirName, filename, qualifier, extName string) string {
 	return path
 }
 
-func extractDirectory(filepath string, depth int) (string, error) {
-	parts := strings.Split(filepath, "/")
-	if len(parts) == 0 {
-		return "", fmt.Errorf("cannot get directory")
+// extractDirectory returns path component `depth` of `inPath` without its extension. Negative
+// depths count back from the end, so -1 is the file name and -2 its parent directory. Both "/" and
+// the OS separator split components.
+func extractDirectory(inPath string, depth int) (string, error) {
+	parts := strings.Split(filepath.ToSlash(inPath), "/")
+	i := depth
+	if i < 0 {
+		i += len(parts)
 	}
-	if depth == -1 {
-		fileName := parts[len(parts)-1]
-		dirName := strings.Split(fileName, ".")[0]
-		return dirName, nil
-	} else {
-		return strings.Split(parts[depth], ".")[0], nil
+	if i < 0 || i >= len(parts) {
+		return "", fmt.Errorf("path %q is too shallow for component %d", inPath, depth)
 	}
+	return strings.Split(parts[i], ".")[0], nil
 }
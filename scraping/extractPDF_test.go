@@ -0,0 +1,884 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/core"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/pdfutil"
+)
+
+// positionedTable returns a one-cell table named `name` whose cell's top-left corner is at `x`, `y`.
+func positionedTable(name string, x, y float64) extractor.TextTable {
+	cell := extractor.TableCell{PdfRectangle: model.PdfRectangle{Llx: x, Lly: y - 10, Urx: x + 50, Ury: y}, Text: name}
+	return extractor.TextTable{W: 1, H: 1, Cells: [][]extractor.TableCell{{cell}}}
+}
+
+func TestSortTablesByPosition(t *testing.T) {
+	// Two rows of tables, the tops of each row a rounding error apart.
+	tables := []extractor.TextTable{
+		positionedTable("top left", 50, 700.0004),
+		positionedTable("top middle", 200, 699.9996),
+		positionedTable("top right", 350, 700.3),
+		positionedTable("bottom left", 50, 400),
+		positionedTable("bottom right", 300, 400.0001),
+	}
+	want := []string{"top left", "top middle", "top right", "bottom left", "bottom right"}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		scrambled := append([]extractor.TextTable(nil), tables...)
+		rng.Shuffle(len(scrambled), func(i, j int) { scrambled[i], scrambled[j] = scrambled[j], scrambled[i] })
+		sortTablesByPosition(scrambled)
+		var got []string
+		for _, table := range scrambled {
+			got = append(got, table.Cells[0][0].Text)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("sorted order = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestTableEdges(t *testing.T) {
+	// An A4 page. The margins are 5% of its height, about 42pt.
+	a4 := model.PdfRectangle{Llx: 0, Lly: 0, Urx: 595, Ury: 842}
+	// tallTable returns a table from y `top` down to y `bottom`.
+	tallTable := func(top, bottom float64) extractor.TextTable {
+		table := positionedTable("menu", 50, top)
+		table.Cells[0][0].Lly = bottom
+		return table
+	}
+	tests := []struct {
+		name        string
+		tables      []extractor.TextTable
+		top, bottom bool
+	}{
+		{"no tables", nil, false, false},
+		{"table inside the margins", []extractor.TextTable{tallTable(700, 100)}, false, false},
+		{"table cut at the bottom edge", []extractor.TextTable{tallTable(700, 20)}, false, true},
+		{"table continued at the top edge", []extractor.TextTable{tallTable(830, 400)}, true, false},
+		{"full-page table", []extractor.TextTable{tallTable(830, 10)}, true, true},
+		// Only the first table is checked against the top and the last against the bottom.
+		{"notes below a cut table", []extractor.TextTable{tallTable(830, 10), tallTable(300, 200)}, true, false},
+	}
+	for _, tc := range tests {
+		top, bottom := tableEdges(tc.tables, a4)
+		if top != tc.top || bottom != tc.bottom {
+			t.Errorf("%s: tableEdges = %v, %v, want %v, %v", tc.name, top, bottom, tc.top, tc.bottom)
+		}
+	}
+}
+
+func TestDescribeContinuedPages(t *testing.T) {
+	r := docTables{
+		pageTables:     map[int][]stringTable{1: {{{"4/1"}}}, 2: {{{"4/16"}}}},
+		continuedPages: []int{1},
+	}
+	got := r.describe(2)
+	want := "2 pages 2 tables\n" +
+		"   page 1: 1 tables\n" +
+		"      last table may be cut off and continue on page 2\n" +
+		"   page 2: 1 tables\n"
+	if got != want {
+		t.Errorf("describe(2) =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExtractPagesTracesOnlyTracePage(t *testing.T) {
+	logger := common.Log
+	common.SetLogger(common.NewConsoleLogger(common.LogLevelInfo))
+	defer common.SetLogger(logger)
+
+	const tracePage = 3
+	var traced []int
+	extractPage := func(pageNum int) (pageExtract, error) {
+		if common.Log.IsLogLevel(common.LogLevelTrace) {
+			traced = append(traced, pageNum)
+		}
+		raw := positionedTable(fmt.Sprintf("page %d", pageNum), 50, 700)
+		return pageExtract{tables: []stringTable{asStringTable(raw)}, raw: []extractor.TextTable{raw}}, nil
+	}
+	r, err := extractPages(context.Background(), "apr.pdf", 2, 4, tracePage, extractPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{tracePage}; !reflect.DeepEqual(traced, want) {
+		t.Errorf("pages extracted with trace logging = %v, want %v", traced, want)
+	}
+	if common.Log.IsLogLevel(common.LogLevelTrace) {
+		t.Error("trace logging left on after the trace page")
+	}
+	if r.trace == nil || r.trace.pageNum != tracePage || len(r.trace.tables) != 1 ||
+		r.trace.tables[0].Cells[0][0].Text != "page 3" {
+		t.Fatalf("trace = %+v, want the raw tables of page %d", r.trace, tracePage)
+	}
+
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	if err := r.trace.save(csvRoot); err != nil {
+		t.Fatal(err)
+	}
+	dumps, err := filepath.Glob(csvRoot + ".page*.trace.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{csvRoot + ".page3.trace.txt"}; !reflect.DeepEqual(dumps, want) {
+		t.Errorf("trace dumps = %q, want %q", dumps, want)
+	}
+	dump, err := os.ReadFile(dumps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "page 3: 1 tables\n" +
+		"table 1: 1x1 bbox=(0.00 0.00 0.00 0.00)\n" +
+		"  [0,0] (50.00 690.00 100.00 700.00) \"page 3\"\n"
+	if string(dump) != want {
+		t.Errorf("trace dump =\n%s\nwant\n%s", dump, want)
+	}
+}
+
+func TestExtractPagesNoTracePage(t *testing.T) {
+	r, err := extractPages(context.Background(), "apr.pdf", 1, 2, 5, func(pageNum int) (pageExtract, error) {
+		return pageExtract{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.trace != nil {
+		t.Errorf("trace = %+v for a page outside the range, want none", r.trace)
+	}
+}
+
+func TestExtractPagesStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var extracted []int
+	_, err := extractPages(ctx, "apr.pdf", 1, 3, 0, func(pageNum int) (pageExtract, error) {
+		extracted = append(extracted, pageNum)
+		cancel()
+		return pageExtract{}, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("extractPages after cancel: err = %v, want context.Canceled", err)
+	}
+	if want := []int{1}; !reflect.DeepEqual(extracted, want) {
+		t.Errorf("extracted pages %v, want %v", extracted, want)
+	}
+}
+
+// contentPage returns a page whose content stream is `content`, encoded with `encoder`.
+func contentPage(t *testing.T, content string, encoder core.StreamEncoder) *model.PdfPage {
+	page := model.NewPdfPage()
+	if err := page.SetContentStreams([]string{content}, encoder); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestContentStreamBytes(t *testing.T) {
+	// A megabyte of content that deflates to about two kilobytes.
+	bomb := strings.Repeat("0 0 m ", 1<<20/6)
+	tests := []struct {
+		name    string
+		content string
+		encoder core.StreamEncoder
+		limit   int
+		want    int
+	}{
+		{"raw", "BT (4/1) Tj ET", core.NewRawEncoder(), 1000, 14},
+		{"flate under the limit", bomb, core.NewFlateEncoder(), 2 << 20, len(bomb)},
+		// Counting stops just past the limit, however far the stream inflates.
+		{"flate over the limit", bomb, core.NewFlateEncoder(), 1000, 1001},
+	}
+	for _, tc := range tests {
+		got, err := contentStreamBytes(contentPage(t, tc.content, tc.encoder), tc.limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: contentStreamBytes = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestExtractTablesFromPageSkipsOversizedPage(t *testing.T) {
+	logs := captureLog(t)
+	page := contentPage(t, strings.Repeat("0 0 m ", 1<<20/6), core.NewFlateEncoder())
+	if stream, _ := core.GetStream(page.GetContentStreamObjs()[0]); len(stream.Stream) > 10000 {
+		t.Fatalf("stub page's encoded content is %d bytes, want it under the limit", len(stream.Stream))
+	}
+	got, err := extractTablesFromPage(page, 2, pageOptions{maxPageBytes: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, pageExtract{}) {
+		t.Errorf("extractTablesFromPage of an oversized page = %+v, want nothing", got)
+	}
+	if want := "warning: skipping page 2: "; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want it to contain %q", logs, want)
+	}
+}
+
+// uncreatableDir returns a directory path that can't be created, even by root: its parent is a
+// regular file.
+func uncreatableDir(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(file, "outcsv")
+}
+
+func TestMakeDirErrUncreatable(t *testing.T) {
+	dir := uncreatableDir(t)
+	if err := makeDirErr("CSV directory", dir); err == nil {
+		t.Errorf("makeDirErr(%q) succeeded", dir)
+	}
+	for _, dir := range []string{".", ".."} {
+		if err := makeDirErr("CSV directory", dir); err == nil {
+			t.Errorf("makeDirErr(%q) succeeded", dir)
+		}
+	}
+	if err := makeDirErr("CSV directory", ""); err != nil {
+		t.Errorf("makeDirErr(\"\") = %v, want nil", err)
+	}
+}
+
+func TestExtractPDFUncreatableCSVDir(t *testing.T) {
+	err := extractPDF(context.Background(), []string{filepath.Join(t.TempDir(), "*.pdf")}, csvDir(uncreatableDir(t)))
+	if err == nil {
+		t.Errorf("extractPDF into an uncreatable CSV directory succeeded")
+	}
+}
+
+func TestFileSizeMBMissingFile(t *testing.T) {
+	if _, err := fileSizeMB(filepath.Join(t.TempDir(), "gone.pdf")); err == nil {
+		t.Errorf("fileSizeMB of a missing file succeeded")
+	}
+}
+
+// csvTable is a table with the fields that WriteCSV's fast path and encoding/csv must agree on.
+var csvTable = stringTable{
+	{"date", "breakfast", "dinner"},
+	{"1", "rice", "curry"},
+	{`\.`, "a,b", `say "hi"`},
+	{" leading space", "trailing space ", "\ttab"},
+	{"", "", ""},
+	{"", "x", ""},
+	{"ご飯", "味噌汁", "鶏の唐揚げ 甘酢あんかけ"},
+	{"line\nbreak", "cr\rreturn", "#comment"},
+	{"ragged"},
+}
+
+func TestWriteCSVMatchesEncodingCSV(t *testing.T) {
+	for y, row := range csvTable {
+		t.Run(fmt.Sprint(y), func(t *testing.T) {
+			table := stringTable{row}
+			got := new(bytes.Buffer)
+			if err := WriteCSV(got, table); err != nil {
+				t.Fatal(err)
+			}
+			want := new(bytes.Buffer)
+			w := csv.NewWriter(want)
+			if err := w.WriteAll(table.padded()); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("WriteCSV(%q) = %q, encoding/csv writes %q", row, got, want)
+			}
+		})
+	}
+
+	// The whole table, ragged row included, reads back as written, padded.
+	b := new(bytes.Buffer)
+	if err := WriteCSV(b, csvTable); err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(b)
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := csvTable.padded(); !reflect.DeepEqual(stringTable(rows), want) {
+		t.Errorf("read back %q\nwant %q", rows, want)
+	}
+}
+
+func BenchmarkWriteCSV(b *testing.B) {
+	var table stringTable
+	for y := 0; y < 200; y++ {
+		row := make([]string, 12)
+		for x := range row {
+			if x%4 == 0 {
+				row[x] = fmt.Sprintf("ご飯 %d", y) // needs encoding/csv
+			} else {
+				row[x] = fmt.Sprintf("%d.%d", y, x)
+			}
+		}
+		table = append(table, row)
+	}
+	plain := make(stringTable, len(table))
+	for y, row := range table {
+		plain[y] = append([]string{}, row...)
+		for x := range plain[y] {
+			plain[y][x] = strings.ReplaceAll(plain[y][x], "ご飯", "rice")
+		}
+	}
+	for name, t := range map[string]stringTable{"ascii": plain, "cjk": table} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := WriteCSV(io.Discard, t); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterEmptyTable(t *testing.T) {
+	r := docTables{pageTables: map[int][]stringTable{
+		1: {{}, {{"a", "b"}, {"c", "d"}}},
+		2: {{}},
+	}}
+	for _, tc := range []struct {
+		width, height int
+		want          map[int][]stringTable
+	}{
+		{1, 1, map[int][]stringTable{1: {{{"a", "b"}, {"c", "d"}}}}},
+		{0, 0, r.pageTables},
+	} {
+		got := r.filter(tc.width, tc.height)
+		if !reflect.DeepEqual(got.pageTables, tc.want) {
+			t.Errorf("filter(%d, %d) = %q, want %q", tc.width, tc.height, got.pageTables, tc.want)
+		}
+	}
+}
+
+func TestMergeWrappedRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		table stringTable
+		want  stringTable
+	}{
+		{
+			"wrapped cells",
+			stringTable{
+				{"4/1", "ご飯", "鶏の唐揚げ"},
+				{"", "", "タルタルソース"},
+				{"", "味噌汁", ""},
+				{"4/2", "パン", "カレー"},
+			},
+			stringTable{
+				{"4/1", "ご飯 味噌汁", "鶏の唐揚げ タルタルソース"},
+				{"4/2", "パン", "カレー"},
+			},
+		},
+		{
+			"leading row with an empty label",
+			stringTable{
+				{"", "朝食", "夕食"},
+				{"", "", "(日替わり)"},
+				{"4/1", "ご飯", "カレー"},
+				{"", "", "サラダ"},
+			},
+			stringTable{
+				{"", "朝食", "夕食"},
+				{"", "", "(日替わり)"},
+				{"4/1", "ご飯", "カレー サラダ"},
+			},
+		},
+		{
+			"all-empty rows",
+			stringTable{
+				{"", "", ""},
+				{"4/1", "ご飯", "カレー"},
+				{"", "", ""},
+				{},
+				{"", "", "サラダ"},
+				{"", "", ""},
+			},
+			stringTable{
+				{"4/1", "ご飯", "カレー サラダ"},
+			},
+		},
+		{
+			"continuation wider than its row",
+			stringTable{
+				{"4/1", "ご飯"},
+				{"", "味噌汁", "余り"},
+			},
+			stringTable{
+				{"4/1", "ご飯 味噌汁"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.table.mergeWrappedRows(" ")
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("mergeWrappedRows =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeWrappedRowsLeavesInputAlone(t *testing.T) {
+	table := stringTable{{"4/1", "ご飯"}, {"", "味噌汁"}}
+	table.mergeWrappedRows("/")
+	if want := (stringTable{{"4/1", "ご飯"}, {"", "味噌汁"}}); !reflect.DeepEqual(table, want) {
+		t.Errorf("mergeWrappedRows changed its table to %q", table)
+	}
+}
+
+func TestSaveCSVFilesSkipUnchanged(t *testing.T) {
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	r := docTables{pageTables: map[int][]stringTable{
+		1: {{{"4/1", "パン"}}, {{"4/2", "ご飯"}}},
+		2: {{{"4/8", "うどん"}}},
+	}}
+	if err := r.saveCSVFiles(csvRoot, true); err != nil {
+		t.Fatal(err)
+	}
+	paths := r.csvPaths(csvRoot)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, path := range paths {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A corrected day in the second table of page 1.
+	r.pageTables[1][1] = stringTable{{"4/2", "カレー"}}
+	if err := r.saveCSVFiles(csvRoot, true); err != nil {
+		t.Fatal(err)
+	}
+	for i, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rewritten, want := !fi.ModTime().Equal(old), i == 1; rewritten != want {
+			t.Errorf("%s rewritten %v, want %v", filepath.Base(path), rewritten, want)
+		}
+	}
+	if got, err := os.ReadFile(paths[1]); err != nil || string(got) != "4/2,カレー\n" {
+		t.Errorf("%s = %q, %v, want the corrected table", filepath.Base(paths[1]), got, err)
+	}
+
+	// Without skipUnchanged every file is rewritten.
+	for _, path := range paths {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.saveCSVFiles(csvRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err != nil || fi.ModTime().Equal(old) {
+			t.Errorf("%s not rewritten without skipUnchanged (err %v)", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestGrepTables(t *testing.T) {
+	special := stringTable{{"日付", "夕食"}, {"4/10", "特別メニュー ステーキ"}}
+	later := stringTable{{"日付", "夕食"}, {"4/24", "特別メニュー"}}
+	plain := stringTable{{"日付", "夕食"}, {"4/11", "カレー"}}
+	r := docTables{pageTables: map[int][]stringTable{
+		1: {plain, special},
+		2: {plain},
+		3: {later, plain},
+	}}
+	tests := []struct {
+		keyword string
+		want    map[int][]stringTable
+	}{
+		{"特別メニュー", map[int][]stringTable{1: {special}, 3: {later}}},
+		// The keyword is normalized like the extracted cells, so half-width katakana matches.
+		{"特別ﾒﾆｭｰ", map[int][]stringTable{1: {special}, 3: {later}}},
+		{"4/11", map[int][]stringTable{1: {plain}, 2: {plain}, 3: {plain}}},
+		{"ハンバーグ", map[int][]stringTable{}},
+	}
+	for _, tc := range tests {
+		got := r.grep(tc.keyword)
+		if !reflect.DeepEqual(got.pageTables, tc.want) {
+			t.Errorf("grep(%q) = %q, want %q", tc.keyword, got.pageTables, tc.want)
+		}
+	}
+}
+
+func TestCSVPaths(t *testing.T) {
+	csvRoot := filepath.Join(t.TempDir(), "2024PDF", "apr", "apr")
+	r := docTables{pageTables: map[int][]stringTable{
+		10: {{{"a"}}},
+		2:  {{{"b"}}, {{"c"}}, {{"d"}}},
+		1:  {{{"e"}}},
+	}}
+	// Pages are in numeric order, so page10 comes after page2.
+	want := []string{
+		csvRoot + ".page1.table1.csv",
+		csvRoot + ".page2.table1.csv",
+		csvRoot + ".page2.table2.csv",
+		csvRoot + ".page2.table3.csv",
+		csvRoot + ".page10.table1.csv",
+	}
+	got := r.csvPaths(csvRoot)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("csvPaths =\n%q\nwant\n%q", got, want)
+	}
+	if _, err := os.Stat(filepath.Dir(csvRoot)); !os.IsNotExist(err) {
+		t.Errorf("csvPaths touched the file system: %v", err)
+	}
+
+	// saveCSVFiles writes exactly those files, with the tables in the same order.
+	if err := os.MkdirAll(filepath.Dir(csvRoot), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.saveCSVFiles(csvRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	written, err := filepath.Glob(filepath.Join(filepath.Dir(csvRoot), "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != len(want) {
+		t.Errorf("saveCSVFiles wrote %q, want %q", written, want)
+	}
+	for i, table := range r.tables() {
+		if got, err := os.ReadFile(want[i]); err != nil || string(got) != table.csv() {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(want[i]), got, err, table.csv())
+		}
+	}
+}
+
+func TestCSVPathsNoTables(t *testing.T) {
+	if got := (docTables{}).csvPaths("apr"); len(got) != 0 {
+		t.Errorf("csvPaths of no tables = %q, want none", got)
+	}
+}
+
+func TestApplyOptionsKeepEmpty(t *testing.T) {
+	menu := stringTable{{"日付", "朝食", "夕食"}, {"4/1", "パン", "カレー"}, {"4/2", "ご飯", "うどん"}}
+	r := docTables{pageTables: map[int][]stringTable{
+		1: {{}, menu, {{"注"}}},
+		2: {{}},
+	}}
+	opts := Options{Width: 3, Height: 3}
+	filtered := r.applyOptions(opts)
+	if want := map[int][]stringTable{1: {menu}}; !reflect.DeepEqual(filtered.pageTables, want) {
+		t.Errorf("applyOptions = %q, want %q", filtered.pageTables, want)
+	}
+
+	opts.KeepEmpty = true
+	kept := r.applyOptions(opts)
+	if !reflect.DeepEqual(kept.pageTables, r.pageTables) {
+		t.Errorf("applyOptions with KeepEmpty = %q, want every table %q", kept.pageTables, r.pageTables)
+	}
+	// The empty tables are written too, as empty CSV files.
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	if err := kept.saveCSVFiles(csvRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{csvRoot + ".page1.table1.csv", csvRoot + ".page2.table1.csv"} {
+		if got, err := os.ReadFile(path); err != nil || len(got) != 0 {
+			t.Errorf("%s = %q, %v, want an empty file", filepath.Base(path), got, err)
+		}
+	}
+}
+
+func TestSaveSummary(t *testing.T) {
+	r := docTables{pageTables: map[int][]stringTable{
+		1: {{{"日付", "朝食"}, {"4/1", "パン"}}},
+		2: {{{"4/8", ""}}, {{"注"}}},
+	}}
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	for level := 1; level <= 4; level++ {
+		if err := r.saveSummary(csvRoot, level); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(csvRoot + ".summary.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := r.describe(level); string(got) != want {
+			t.Errorf("level %d summary =\n%s\nwant describe(%d)\n%s", level, got, level, want)
+		}
+	}
+	want := "" +
+		"2 pages 3 tables\n" +
+		"   page 1: 1 tables\n" +
+		"      table 1: 2 x 2\n" +
+		"        [\"日付\", \"朝食\"]\n" +
+		"        [\"4/1\", \"パン\"]\n" +
+		"   page 2: 2 tables\n" +
+		"      table 1: 2 x 1\n" +
+		"        [\"4/8\", ]\n" +
+		"      table 2: 1 x 1\n" +
+		"        [\"注\"]\n"
+	if got := r.describe(4); got != want {
+		t.Errorf("describe(4) =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCSVRootFuncCustomLayout(t *testing.T) {
+	outDir := t.TempDir()
+	// A flat layout: every PDF's CSVs straight in outDir, named <year>-<name>.
+	flat := func(inPath string) (string, error) {
+		year, err := extractDirectory(inPath, -2)
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
+		return filepath.Join(outDir, strings.TrimSuffix(year, "PDF")+"-"+name), nil
+	}
+	var opts Options
+	CSVRootFunc(flat)(&opts)
+
+	inPath := filepath.Join("PDF", "2024PDF", "apr.pdf")
+	csvRoot, err := resultCSVRoot(inPath, docTables{}, opts.CSVRootFunc, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outDir, "2024-apr"); csvRoot != want {
+		t.Errorf("csvRoot = %q, want %q", csvRoot, want)
+	}
+	r := docTables{pageTables: map[int][]stringTable{1: {{{"4/1", "パン"}}}}}
+	if err := r.saveCSVFiles(csvRoot, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "2024-apr.page1.table1.csv")); err != nil {
+		t.Errorf("CSV not written in the custom layout: %v", err)
+	}
+
+	if _, err := resultCSVRoot("apr.pdf", docTables{}, opts.CSVRootFunc, opts); err == nil {
+		t.Error("resultCSVRoot didn't return the layout function's error")
+	}
+}
+
+func TestWriteSummarySourceAndRun(t *testing.T) {
+	r := docTables{
+		pageTables: map[int][]stringTable{1: {{{"4/1", "パン"}}}},
+		sourceURL:  "https://example.com/kondate/2024PDF/apr.pdf",
+		runID:      "20240401T060000Z-1a2b3c4d",
+	}
+	var b bytes.Buffer
+	if err := WriteSummary(&b, r, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := "source: https://example.com/kondate/2024PDF/apr.pdf\n" +
+		"run: 20240401T060000Z-1a2b3c4d\n" +
+		r.describe(2)
+	if b.String() != want {
+		t.Errorf("WriteSummary =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestExtractDirectory(t *testing.T) {
+	tests := []struct {
+		path  string
+		depth int
+		want  string
+		ok    bool
+	}{
+		{"PDF/2024PDF/apr.pdf", -1, "apr", true},
+		{"PDF/2024PDF/apr.pdf", -2, "2024PDF", true},
+		{"PDF/2024PDF/apr.pdf", 1, "2024PDF", true},
+		{"apr.pdf", 1, "", false},
+		{"apr.pdf", -2, "", false},
+		{"PDF/apr.pdf", -3, "", false},
+	}
+	for _, tc := range tests {
+		got, err := extractDirectory(tc.path, tc.depth)
+		if got != tc.want || (err == nil) != tc.ok {
+			t.Errorf("extractDirectory(%q, %d) = %q, %v, want %q, ok %v", tc.path, tc.depth, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestDefaultCSVRootTooShallow(t *testing.T) {
+	root := defaultCSVRoot("outcsv")
+	if got, err := root("apr.pdf"); err == nil {
+		t.Errorf("defaultCSVRoot(%q) = %q, want an error for the missing year directory", "apr.pdf", got)
+	}
+	got, err := root(filepath.Join("PDF", "2024PDF", "apr.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("outcsv", "2024PDF", "apr", "apr"); got != want {
+		t.Errorf("defaultCSVRoot = %q, want %q", got, want)
+	}
+}
+
+func TestMenuTitle(t *testing.T) {
+	// First-page text as the extractor returns it, with full-width digits and spaces.
+	text := "新居浜工業高等専門学校\n　寮食堂\n２０２４年４月　Ａ棟　献立表\n日 曜 朝食 昼食 夕食\n"
+	if got, want := menuTitle(text), "2024年4月 A棟 献立表"; got != want {
+		t.Errorf("menuTitle = %q, want %q", got, want)
+	}
+	if got := menuTitle("寮食堂\n4/1 月 ごはん\n"); got != "" {
+		t.Errorf("menuTitle of a page without a title = %q, want \"\"", got)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name, title, want string
+	}{
+		{"japanese", "2024年4月 A棟 献立", "2024年4月_A棟_献立"},
+		{"full-width", "２０２４年４月　Ａ棟　献立表", "2024年4月_A棟_献立表"},
+		{"punctuation", "4/1～4/30: 献立 (A棟)?", "4_1~4_30_献立_(A棟)"},
+		{"path", `..\evil`, "evil"},
+		{"only unsafe characters", "  / . ", ""},
+		{"empty", "", ""},
+		{"long", strings.Repeat("献立", 30), strings.Repeat("献立", 20)},
+		{"long cut at a separator", strings.Repeat("献", 39) + " 立", strings.Repeat("献", 39)},
+	}
+	for _, tc := range tests {
+		if got := slugify(tc.title); got != tc.want {
+			t.Errorf("%s: slugify(%q) = %q, want %q", tc.name, tc.title, got, tc.want)
+		}
+	}
+}
+
+func TestTitledCSVRoot(t *testing.T) {
+	csvRoot := filepath.Join("outcsv", "2024PDF", "apr", "apr")
+	if got, want := titledCSVRoot(csvRoot, "2024年4月 A棟 献立"), csvRoot+".2024年4月_A棟_献立"; got != want {
+		t.Errorf("titledCSVRoot with a title = %q, want %q", got, want)
+	}
+	// Without a usable title the files keep the PDF's base name.
+	for _, title := range []string{"", " ? "} {
+		if got := titledCSVRoot(csvRoot, title); got != csvRoot {
+			t.Errorf("titledCSVRoot(%q) = %q, want %q", title, got, csvRoot)
+		}
+	}
+}
+
+func TestExtractPDFStartAt(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	// None of these open as PDFs, so each file that isn't skipped fails.
+	writeFiles(t, dir, map[string]string{"a.pdf": "not a PDF", "b.pdf": "not a PDF", "c.pdf": "not a PDF"})
+	pattern := filepath.Join(dir, "*.pdf")
+	err := extractPDF(context.Background(), []string{pattern}, csvDir(t.TempDir()), StartAt(2))
+	if err == nil || !strings.Contains(err.Error(), "2 of 3 PDF files failed") {
+		t.Fatalf("extractPDF starting at file 2 = %v, want files 2 and 3 to fail", err)
+	}
+	if first := filepath.Join(dir, "a.pdf"); strings.Contains(err.Error(), first) {
+		t.Errorf("file 1 was extracted when starting at file 2: %v", err)
+	}
+	if want := "Skipping 1 of 3"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want it to contain %q", logs, want)
+	}
+
+	for _, startAt := range []int{0, -1, 4} {
+		err := extractPDF(context.Background(), []string{pattern}, csvDir(t.TempDir()), StartAt(startAt))
+		if err == nil || !strings.Contains(err.Error(), "out of range 1-3") {
+			t.Errorf("extractPDF starting at file %d = %v, want it rejected as out of range", startAt, err)
+		}
+	}
+}
+
+func TestPageRotation(t *testing.T) {
+	// rotatedPage returns an A4 page with /Rotate `rotate`, or none if `rotate` is nil.
+	rotatedPage := func(rotate *int64) *model.PdfPage {
+		page := model.NewPdfPage()
+		page.MediaBox = &model.PdfRectangle{Urx: 595, Ury: 842}
+		page.Rotate = rotate
+		return page
+	}
+	degrees := func(d int64) *int64 { return &d }
+	tests := []struct {
+		name   string
+		rotate *int64
+		want   int64
+	}{
+		{"none", nil, 0},
+		{"0", degrees(0), 0},
+		{"90", degrees(90), 90},
+		{"180", degrees(180), 180},
+		{"270", degrees(270), 270},
+		{"over a full turn", degrees(450), 90},
+		{"negative", degrees(-90), 270},
+	}
+	for _, tc := range tests {
+		if got := pageRotation(rotatedPage(tc.rotate)); got != tc.want {
+			t.Errorf("%s: pageRotation = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// /Rotate inherited from the page tree.
+	page := rotatedPage(nil)
+	grandparent := core.MakeDict()
+	grandparent.Set("Rotate", core.MakeInteger(180))
+	parent := core.MakeDict()
+	parent.Set("Parent", grandparent)
+	page.Parent = parent
+	if got := pageRotation(page); got != 180 {
+		t.Errorf("inherited: pageRotation = %d, want 180", got)
+	}
+	page.Parent = core.MakeInteger(1)
+	if got := pageRotation(page); got != 0 {
+		t.Errorf("broken page tree: pageRotation = %d, want 0", got)
+	}
+
+	for _, rotate := range []int64{90, 180, 270} {
+		page := rotatedPage(degrees(rotate))
+		if err := pdfutil.NormalizePage(page); err != nil {
+			t.Fatal(err)
+		}
+		if got := pageRotation(page); got != 0 {
+			t.Errorf("pageRotation after NormalizePage of a %d degree page = %d, want 0", rotate, got)
+		}
+	}
+}
+
+func TestExtractorOptionsReachExtractor(t *testing.T) {
+	var got *extractor.Options
+	errStub := errors.New("stub extractor")
+	saved := newExtractor
+	newExtractor = func(page *model.PdfPage, options *extractor.Options) (*extractor.Extractor, error) {
+		got = options
+		return nil, errStub
+	}
+	t.Cleanup(func() { newExtractor = saved })
+
+	tests := []struct {
+		name   string
+		option Option
+		want   *extractor.Options
+	}{
+		{"defaults", nil, nil},
+		{"crop box", ApplyCropBox(true), &extractor.Options{ApplyCropBox: true}},
+		{"annotations", IncludeAnnotations(true), &extractor.Options{IncludeAnnotations: true}},
+		{"no document tags", DisableDocumentTags(true), &extractor.Options{DisableDocumentTags: true}},
+	}
+	for _, tc := range tests {
+		var opts Options
+		if tc.option != nil {
+			tc.option(&opts)
+		}
+		got = nil
+		page := contentPage(t, "BT (4/1) Tj ET", core.NewRawEncoder())
+		page.MediaBox = &model.PdfRectangle{Urx: 595, Ury: 842}
+		if _, err := extractTablesFromPage(page, 1, opts.pageOptions()); !errors.Is(err, errStub) {
+			t.Fatalf("%s: extractTablesFromPage = %v, want the stub's error", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: extractor options = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reFootnoteMark matches a footnote mark such as "※1" in normalized text.
+var reFootnoteMark = regexp.MustCompile(`※\s*(\d+)`)
+
+// parseFootnotes returns the footnote legend in page text `text`: the text of each mark, e.g.
+// "※1" → "小麦を含みます", from the lines that start with a mark. A line may define several
+// marks, as in "※1 小麦 ※2 卵". A mark defined more than once keeps its first text, and marks
+// with no text are ignored.
+func parseFootnotes(text string) map[string]string {
+	legend := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = normalize(line)
+		marks := reFootnoteMark.FindAllStringSubmatchIndex(line, -1)
+		if len(marks) == 0 || marks[0][0] != 0 {
+			continue
+		}
+		for i, m := range marks {
+			end := len(line)
+			if i+1 < len(marks) {
+				end = marks[i+1][0]
+			}
+			mark := "※" + line[m[2]:m[3]]
+			note := strings.TrimSpace(strings.TrimLeft(line[m[1]:end], " :.)"))
+			if _, ok := legend[mark]; !ok && note != "" {
+				legend[mark] = note
+			}
+		}
+	}
+	return legend
+}
+
+// footnotesOf returns the entries of `legend` for the footnote marks in `items`, or nil if they
+// have none that `legend` has.
+func footnotesOf(items []string, legend map[string]string) map[string]string {
+	var footnotes map[string]string
+	for _, item := range items {
+		for _, m := range reFootnoteMark.FindAllStringSubmatch(item, -1) {
+			mark := "※" + m[1]
+			if note, ok := legend[mark]; ok {
+				if footnotes == nil {
+					footnotes = make(map[string]string)
+				}
+				footnotes[mark] = note
+			}
+		}
+	}
+	return footnotes
+}
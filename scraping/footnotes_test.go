@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFootnotes(t *testing.T) {
+	text := "令和6年4月の献立\n" +
+		"日付 夕食\n1 カレー※1\n" +
+		"※１：小麦を含みます\n" +
+		"※2 卵を含みます ※3) 当日の仕入れにより変わります\n" +
+		"※ 献立は変更になる場合があります\n" +
+		"※1 重複した説明\n" +
+		"※4"
+	want := map[string]string{
+		"※1": "小麦を含みます",
+		"※2": "卵を含みます",
+		"※3": "当日の仕入れにより変わります",
+	}
+	if got := parseFootnotes(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFootnotes = %q, want %q", got, want)
+	}
+}
+
+func TestParseMealsFootnotes(t *testing.T) {
+	page := func(text string, table stringTable) func() pageExtract {
+		return func() pageExtract {
+			return pageExtract{tables: []stringTable{table}, lineTables: []stringTable{table}, text: text}
+		}
+	}
+	pages := map[int]func() pageExtract{
+		1: page("令和6年4月の献立\n※1 小麦を含みます\n※2 卵を含みます",
+			stringTable{{"日付", "昼食", "夕食"}, {"1", "カレー※1\nサラダ", "オムレツ※2\nパン※1"}}),
+		2: page("※2 ほかの説明\n※3 えびを含みます",
+			stringTable{{"日付", "昼食", "夕食"}, {"2", "天ぷら※3\n味噌汁※9", "焼き魚"}}),
+	}
+	r, err := extractPages(context.Background(), "apr.pdf", 1, 2, 0, func(pageNum int) (pageExtract, error) {
+		return pages[pageNum](), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meals, _, err := ParseMeals(r, MealOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"※1": "小麦を含みます"},
+		{"※1": "小麦を含みます", "※2": "卵を含みます"},
+		{"※3": "えびを含みます"}, // ※9 has no legend
+		nil,
+	}
+	var got []map[string]string
+	for _, meal := range meals {
+		got = append(got, meal.Footnotes)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("footnotes of %v =\n%q\nwant\n%q", summarizeMeals(meals), got, want)
+	}
+
+	b := new(bytes.Buffer)
+	if err := WriteMealsJSON(b, meals[:1], false); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"2024-04":[{"date":"2024-04-01","type":"lunch","items":["カレー※1","サラダ"],` +
+		`"footnotes":{"※1":"小麦を含みます"}}]}` + "\n"
+	if b.String() != wantJSON {
+		t.Errorf("WriteMealsJSON =\n%s\nwant\n%s", b, wantJSON)
+	}
+}
+
+func TestCorrectionsKeepMarkedFootnotes(t *testing.T) {
+	day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.Local)
+	corrections := mealCorrections{{"2024-04-01", Dinner}: {Date: "2024-04-01", Type: "dinner", Items: []string{"オムレツ※2"}}}
+	meals := []Meal{{Date: day, Type: Dinner, Items: []string{"オムレツ※2", "パン※1"},
+		Footnotes: map[string]string{"※1": "小麦を含みます", "※2": "卵を含みます"}}}
+	captureLog(t)
+	got := corrections.apply(meals)[0].Footnotes
+	if want := map[string]string{"※2": "卵を含みます"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("corrected footnotes = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// httpClient is the client used for every request the scraper makes.
+var httpClient = http.DefaultClient
+
+// defaultUserAgent is the default for -user-agent. The site sometimes blocks Go's default.
+const defaultUserAgent = "DormMealTracker/1.0"
+
+// userAgent is the User-Agent header sent with page and PDF requests.
+var userAgent = defaultUserAgent
+
+// defaultHTTPTimeout is the default for -http-timeout, so that a hung server fails the request
+// instead of blocking the scraper forever.
+const defaultHTTPTimeout = 30 * time.Second
+
+// httpFlags registers the -ca-file, -insecure, -http-timeout and -user-agent flags on `fs`. The
+// returned function installs an httpClient and userAgent configured from them and must be called
+// after `fs` is parsed.
+func httpFlags(fs *flag.FlagSet) func() error {
+	caFile := fs.String("ca-file", os.Getenv("DORM_CA_FILE"),
+		"PEM file of extra root CA certificates to trust, e.g. for a TLS-intercepting proxy (default $DORM_CA_FILE)")
+	insecure := fs.Bool("insecure", false, "don't verify TLS certificates (testing only)")
+	timeout := fs.Duration("http-timeout", defaultHTTPTimeout, "give up on an HTTP request after this long (0 = no limit)")
+	agent := fs.String("user-agent", defaultUserAgent, "User-Agent header sent with page and PDF requests")
+	return func() error {
+		client, err := newHTTPClient(*caFile, *insecure, *timeout)
+		if err != nil {
+			return err
+		}
+		httpClient = client
+		userAgent = *agent
+		return nil
+	}
+}
+
+// newHTTPClient returns a client that trusts the system roots plus the PEM certificates in
+// `caFile`, if given. If `insecure` is true, certificates aren't verified at all. Requests time out
+// after `timeout`, unless it is 0.
+func newHTTPClient(caFile string, insecure bool, timeout time.Duration) (*http.Client, error) {
+	if caFile == "" && !insecure {
+		return &http.Client{Timeout: timeout}, nil
+	}
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %q", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if insecure {
+		log.Println("WARNING: TLS certificate verification is disabled (-insecure). Don't use this in production.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
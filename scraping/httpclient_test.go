@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientCAFile(t *testing.T) {
+	captureLog(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	// The test server's self-signed certificate stands in for a campus proxy's CA.
+	caFile := filepath.Join(t.TempDir(), "campus-ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		caFile   string
+		insecure bool
+		ok       bool
+	}{
+		{"system roots only", "", false, false},
+		{"custom CA", caFile, false, true},
+		{"insecure", "", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := newHTTPClient(tc.caFile, tc.insecure, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil; ok != tc.ok {
+				t.Errorf("GET succeeded %v, want %v: %v", ok, tc.ok, err)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientBadCAFile(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		caFile string
+		want   string
+	}{
+		{filepath.Join(dir, "missing.pem"), "could not read CA file"},
+		{notPEM, "no PEM certificates found"},
+	}
+	for _, tc := range tests {
+		if _, err := newHTTPClient(tc.caFile, false, 0); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("newHTTPClient(%q) = %v, want an error containing %q", tc.caFile, err, tc.want)
+		}
+	}
+}
+
+func TestNewHTTPClientInsecureWarns(t *testing.T) {
+	logs := captureLog(t)
+	if _, err := newHTTPClient("", true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "WARNING: TLS certificate verification is disabled") {
+		t.Errorf("no warning logged for -insecure: %q", logs.String())
+	}
+}
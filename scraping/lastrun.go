@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lastRunFile is the file in the work directory where -since-last-run records the time of the
+// last successful run and a hash of the menu page it saw.
+const lastRunFile = ".last-run"
+
+// lastRun is what -since-last-run records about the last successful run.
+type lastRun struct {
+	at       time.Time
+	pageHash string // hex SHA-256 of the menu page, "" if unknown
+}
+
+// readLastRun returns the last run recorded in `statePath`, or the zero lastRun if it doesn't
+// exist. The file is the time on the first line, then optionally the page hash.
+func readLastRun(statePath string) (lastRun, error) {
+	b, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return lastRun{}, nil
+	}
+	if err != nil {
+		return lastRun{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(lines[0]))
+	if err != nil {
+		return lastRun{}, fmt.Errorf("%s: %w", statePath, err)
+	}
+	run := lastRun{at: t}
+	if len(lines) > 1 {
+		run.pageHash = strings.TrimSpace(lines[1])
+	}
+	return run, nil
+}
+
+// writeLastRun records `run` in `statePath`.
+func writeLastRun(statePath string, run lastRun) error {
+	state := run.at.UTC().Format(time.RFC3339) + "\n"
+	if run.pageHash != "" {
+		state += run.pageHash + "\n"
+	}
+	return ioutil.WriteFile(statePath, []byte(state), 0666)
+}
+
+// menuChangedSince returns true if the menu page at `url` may have changed since run `since`. The
+// page is requested with If-Modified-Since, so an unchanged page costs a 304. If the server sends
+// the page anyway it is compared with the hash of the page that run saw, and cached at `htmlPath`
+// for this run when it differs. The cache itself isn't compared with, since it may have been
+// written by a run that then failed. A zero `since` always counts as changed.
+func menuChangedSince(ctx context.Context, url, htmlPath string, since lastRun) (bool, error) {
+	if since.at.IsZero() {
+		return true, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("If-Modified-Since", since.at.UTC().Format(http.TimeFormat))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, &httpStatusError{url: url, statusCode: resp.StatusCode, status: resp.Status}
+	}
+	body, err := decodedBody(resp)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", url, err)
+	}
+	defer body.Close()
+	page, err := ioutil.ReadAll(body)
+	if err != nil {
+		return false, err
+	}
+	if looksTruncated(page) {
+		log.Printf("%s: looks truncated (%d bytes), leaving it to the normal download", url, len(page))
+		return true, nil
+	}
+	if sum := sha256.Sum256(page); hex.EncodeToString(sum[:]) == since.pageHash {
+		return false, nil
+	}
+	if err := makeDirecoty(filepath.Dir(htmlPath)); err != nil {
+		return false, err
+	}
+	if err := ioutil.WriteFile(htmlPath, page, 0666); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pageSHA256 returns the hex SHA-256 of `page`, as recorded in lastRun.pageHash.
+func pageSHA256(page string) string {
+	sum := sha256.Sum256([]byte(page))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLastRunRoundTrip(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), lastRunFile)
+	if got, err := readLastRun(statePath); err != nil || !got.at.IsZero() || got.pageHash != "" {
+		t.Errorf("readLastRun with no state file = %+v, %v, want the zero lastRun", got, err)
+	}
+	at := time.Date(2024, 4, 1, 9, 30, 0, 0, time.FixedZone("JST", 9*60*60))
+	for _, want := range []lastRun{{at: at, pageHash: pageSHA256("page")}, {at: at}} {
+		if err := writeLastRun(statePath, want); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readLastRun(statePath); err != nil || !got.at.Equal(want.at) || got.pageHash != want.pageHash {
+			t.Errorf("readLastRun = %+v, %v, want %+v", got, err, want)
+		}
+	}
+	// A state file from before the page hash was recorded.
+	if err := os.WriteFile(statePath, []byte("2024-04-01T00:30:00Z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readLastRun(statePath); err != nil || !got.at.Equal(at) || got.pageHash != "" {
+		t.Errorf("readLastRun of a time-only state file = %+v, %v", got, err)
+	}
+	if err := os.WriteFile(statePath, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readLastRun(statePath); err == nil {
+		t.Error("readLastRun of a garbled state file succeeded")
+	}
+}
+
+// pageServer serves `*page` as the menu page, or 304 when `*page` is "", and counts the requests.
+func pageServer(t *testing.T, page *string, gets *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gets++
+		if *page == "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, *page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMenuChangedSince(t *testing.T) {
+	page := menuPage("2024PDF/apr.pdf")
+	newPage := menuPage("2024PDF/apr.pdf", "2024PDF/may.pdf")
+	at := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		since  lastRun
+		served string // page served; "" answers 304
+		want   bool
+		gets   int
+	}{
+		{"first run", lastRun{}, page, true, 0},
+		{"304", lastRun{at: at, pageHash: pageSHA256(page)}, "", false, 1},
+		{"200 with the last run's page", lastRun{at: at, pageHash: pageSHA256(page)}, page, false, 1},
+		{"200 with a changed page", lastRun{at: at, pageHash: pageSHA256(page)}, newPage, true, 1},
+		{"200 without a recorded hash", lastRun{at: at}, page, true, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gets := 0
+			var ifModifiedSince string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ifModifiedSince = r.Header.Get("If-Modified-Since")
+				gets++
+				if tc.served == "" {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				fmt.Fprint(w, tc.served)
+			}))
+			defer srv.Close()
+
+			htmlPath := filepath.Join(t.TempDir(), "ryoushokuApril.html")
+			if err := os.WriteFile(htmlPath, []byte(page), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := menuChangedSince(context.Background(), srv.URL+"/ryoushoku.html", htmlPath, tc.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("menuChangedSince = %v, want %v", got, tc.want)
+			}
+			if gets != tc.gets {
+				t.Errorf("menu page requested %d times, want %d", gets, tc.gets)
+			}
+			if gets > 0 && ifModifiedSince != at.Format(http.TimeFormat) {
+				t.Errorf("If-Modified-Since = %q, want %q", ifModifiedSince, at.Format(http.TimeFormat))
+			}
+			want := page
+			if tc.want && tc.gets > 0 {
+				want = tc.served
+			}
+			if cached, err := os.ReadFile(htmlPath); err != nil || string(cached) != want {
+				t.Errorf("cached page after menuChangedSince isn't the %s one (err %v)",
+					map[bool]string{true: "old", false: "new"}[want == page], err)
+			}
+		})
+	}
+}
+
+func TestMenuChangedSinceRetriesFailedRun(t *testing.T) {
+	page := menuPage("2024PDF/apr.pdf")
+	newPage := menuPage("2024PDF/apr.pdf", "2024PDF/may.pdf")
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, lastRunFile)
+	htmlPath := filepath.Join(dir, "html", "ryoushokuApril.html")
+	gets := 0
+	served := page
+	srv := pageServer(t, &served, &gets)
+	url := srv.URL + "/ryoushoku.html"
+
+	// run checks the menu page as a -since-last-run run does, and records the run if it
+	// succeeds. It returns whether the page counted as changed.
+	run := func(succeeds bool) bool {
+		t.Helper()
+		prev, err := readLastRun(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		changed, err := menuChangedSince(context.Background(), url, htmlPath, prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed || !succeeds {
+			return changed
+		}
+		if _, err := os.Stat(htmlPath); os.IsNotExist(err) {
+			// The first run downloads the page itself.
+			if err := os.MkdirAll(filepath.Dir(htmlPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(htmlPath, []byte(served), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hash, err := fileSHA256(htmlPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeLastRun(statePath, lastRun{at: time.Now(), pageHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+		return changed
+	}
+
+	if !run(true) {
+		t.Fatal("first run didn't count as changed")
+	}
+	if run(true) {
+		t.Error("unchanged page counted as changed")
+	}
+	served = newPage
+	if !run(false) {
+		t.Fatal("changed page didn't count as changed")
+	}
+	// The failed run cached the new page, but the rerun must still do the work.
+	if !run(true) {
+		t.Error("rerun after a failed run counted as unchanged")
+	}
+	if run(true) {
+		t.Error("page counted as changed after the successful rerun")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pdfLink is a link found in the menu page table.
+type pdfLink struct {
+	path string // href of the link
+	text string // normalized link text, e.g. "2024/04"
+}
+
+// getPDFLinks returns the first link in each row of the menu page table in `readedFile`.
+func getPDFLinks(readedFile *[]byte) ([]pdfLink, error) {
+	if len(*readedFile) == 0 {
+		return nil, fmt.Errorf("readedFile is empty")
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(*readedFile))
+	if err != nil {
+		return nil, err
+	}
+	var links []pdfLink
+	doc.Find("tbody > tr").Each(func(_ int, row *goquery.Selection) {
+		a := row.Find("a").First()
+		path, exists := a.Attr("href")
+		if !exists {
+			return
+		}
+		if len(path) > 0 {
+			links = append(links, pdfLink{path: path, text: normalize(a.Text())})
+		}
+	})
+	return links, nil
+}
+
+// pdfLinkPaths returns the paths of `links`.
+func pdfLinkPaths(links []pdfLink) []string {
+	paths := make([]string, len(links))
+	for i, link := range links {
+		paths[i] = link.path
+	}
+	return paths
+}
+
+// selectMonthLinks returns the paths of the links in `links` that refer to the month of `t`. If
+// none do, it logs a warning and returns all the paths.
+func selectMonthLinks(links []pdfLink, t time.Time) []string {
+	var paths []string
+	for _, link := range links {
+		year, first, last, ok := linkMonths(link)
+		if ok && first <= t.Month() && t.Month() <= last && (year == 0 || year == t.Year()) {
+			paths = append(paths, link.path)
+		}
+	}
+	if len(paths) == 0 {
+		log.Printf("warning: no link for %d/%02d found, using all %d links", t.Year(), t.Month(), len(links))
+		return pdfLinkPaths(links)
+	}
+	return paths
+}
+
+// linkMonths returns the year and the first and last months that `link` refers to. They are read
+// from link text like "2024/04", "2024/07-08" or "2024年4月". Failing that, a single month is read
+// from a file name like "apr.pdf" and the returned year is 0.
+func linkMonths(link pdfLink) (int, time.Month, time.Month, bool) {
+	if m := reLinkYearMonth.FindStringSubmatch(link.text); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		first, _ := strconv.Atoi(m[2])
+		last := first
+		if m[3] != "" {
+			last, _ = strconv.Atoi(m[3])
+		}
+		if 1 <= first && first <= last && last <= 12 {
+			return year, time.Month(first), time.Month(last), true
+		}
+	}
+	base := strings.ToLower(path.Base(link.path))
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if len(base) >= 3 {
+		for month := time.January; month <= time.December; month++ {
+			if strings.HasPrefix(strings.ToLower(month.String()), base) {
+				return 0, month, month, true
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+var reLinkYearMonth = regexp.MustCompile(`(\d{4})\s*[/年.-]\s*(\d{1,2})(?:\s*月?\s*[-~〜]\s*(\d{1,2}))?`)
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetPDFLinks(t *testing.T) {
+	page := []byte(`<html><body><table><tbody>
+<tr><td><a href="2024PDF/apr.pdf">２０２４／０４</a></td><td><a href="2024PDF/apr-en.pdf">English</a></td></tr>
+<tr><td>no link</td></tr>
+<tr><td><a href="">empty</a></td></tr>
+<tr><td><a href="2024PDF/may.pdf">2024年5月</a></td></tr>
+</tbody></table></body></html>`)
+	got, err := getPDFLinks(&page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pdfLink{
+		{path: "2024PDF/apr.pdf", text: "2024/04"},
+		{path: "2024PDF/may.pdf", text: "2024年5月"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getPDFLinks = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinkMonths(t *testing.T) {
+	tests := []struct {
+		link        pdfLink
+		year        int
+		first, last time.Month
+		ok          bool
+	}{
+		{pdfLink{"2024PDF/a.pdf", "2024/04"}, 2024, time.April, time.April, true},
+		{pdfLink{"2024PDF/a.pdf", "2024年4月"}, 2024, time.April, time.April, true},
+		{pdfLink{"2024PDF/a.pdf", "2024/07-08"}, 2024, time.July, time.August, true},
+		{pdfLink{"2024PDF/a.pdf", "2024年7月〜8月"}, 2024, time.July, time.August, true},
+		{pdfLink{"2024PDF/a.pdf", "2024.12"}, 2024, time.December, time.December, true},
+		// Months out of range or backwards fall back to the file name.
+		{pdfLink{"2024PDF/a.pdf", "2024/13"}, 0, 0, 0, false},
+		{pdfLink{"2024PDF/sep.pdf", "2024/09-07"}, 0, time.September, time.September, true},
+		{pdfLink{"2024PDF/apr.pdf", "今月の献立"}, 0, time.April, time.April, true},
+		{pdfLink{"2024PDF/September.PDF", ""}, 0, time.September, time.September, true},
+		{pdfLink{"2024PDF/ma.pdf", ""}, 0, 0, 0, false},
+		{pdfLink{"2024PDF/menu.pdf", "献立表"}, 0, 0, 0, false},
+	}
+	for _, tc := range tests {
+		year, first, last, ok := linkMonths(tc.link)
+		if year != tc.year || first != tc.first || last != tc.last || ok != tc.ok {
+			t.Errorf("linkMonths(%+v) = %d, %s, %s, %v, want %d, %s, %s, %v",
+				tc.link, year, first, last, ok, tc.year, tc.first, tc.last, tc.ok)
+		}
+	}
+}
+
+func TestSelectMonthLinks(t *testing.T) {
+	links := []pdfLink{
+		{path: "2024PDF/jun.pdf", text: "2024/06"},
+		{path: "2024PDF/summer.pdf", text: "2024/07-08"},
+		{path: "2024PDF/sep.pdf", text: ""},
+		{path: "2023PDF/jul.pdf", text: "2023/07"},
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want []string
+		warn bool
+	}{
+		{"single month", time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), []string{"2024PDF/jun.pdf"}, false},
+		{"first of a range", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), []string{"2024PDF/summer.pdf"}, false},
+		{"last of a range", time.Date(2024, 8, 31, 0, 0, 0, 0, time.UTC), []string{"2024PDF/summer.pdf"}, false},
+		{"other year", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), []string{"2023PDF/jul.pdf"}, false},
+		{"file name without a year", time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC), []string{"2024PDF/sep.pdf"}, false},
+		{"no match falls back to all", time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), pdfLinkPaths(links), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+			got := selectMonthLinks(links, tc.t)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("selectMonthLinks = %q, want %q", got, tc.want)
+			}
+			if warned := strings.Contains(logs.String(), "warning: no link for"); warned != tc.warn {
+				t.Errorf("warned %v, want %v: %q", warned, tc.warn, logs.String())
+			}
+		})
+	}
+}
@@ -1,138 +1,982 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			if err := verifyCommand(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		case "list-buildings":
+			if err := listBuildingsCommand(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		case "meals":
+			if err := mealsCommand(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		case "compare-store":
+			if err := compareStoreCommand(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		case "watch":
+			if err := watchCommand(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
+	if err := run(); err != nil {
+		fatal(err)
+	}
+}
+
+// commandUsage is the start of the -help message.
+const commandUsage = `Usage:
+  scraping [flags]                  download this month's menu PDFs and extract their tables to CSV
+  scraping verify [flags] csv...    check generated CSV files
+  scraping meals [flags] csv...     parse the meals in generated (or hand-corrected) CSV files to JSON
+  scraping compare-store -db file [flags] csv...
+                                    show how the meals in generated CSV files differ from the stored ones
+  scraping list-buildings [flags]   list the dorm building pages
+  scraping watch [-interval d] [flags]
+                                    run the scraper with [flags] every interval`
+
+// run parses the command line flags and runs the scraper: it downloads the menu page and PDFs,
+// extracts their tables to CSV and optionally uploads the CSVs. Errors are wrapped with the stage
+// that failed, and keep any sentinel error for exitCode().
+func run() (runErr error) {
+	workDir := flag.String("work-dir", ".", "base directory for the html/, PDF/ and outcsv/ directories")
+	csvDirFlag := flag.String("csvdir", "", "directory to write the CSV files to (default <work-dir>/outcsv)")
+	firstPage := flag.Int("firstpage", 1, "first page to extract tables from")
+	lastPage := flag.Int("lastpage", 10000, "last page to extract tables from")
+	width := flag.Int("width", 0, "minimum table width in cells")
+	height := flag.Int("height", 0, "minimum table height in cells")
+	verbose := flag.Int("verbose", 1, "detail of the table descriptions logged for each PDF (0-3)")
+	debug := flag.Bool("debug", false, "print UniDoc debugging info")
+	trace := flag.Bool("trace", false, "print UniDoc tracing info (more than -debug)")
+	doProfile := flag.Bool("profile", false, "write a CPU profile to cpu.profile")
+	mergeRows := flag.Bool("merge-rows", false, "merge table rows that continue a cell wrapped from the row above")
+	cellJoin := flag.String("cell-join", " ", "separator used when merging wrapped cells")
+	mealsJSON := flag.Bool("meals", false, "write the meals parsed from each PDF's tables to a .meals.json next to the CSVs")
+	jsonPretty := flag.Bool("json-pretty", false, "indent the JSON files for reading (default compact)")
+	dayTextDir := flag.String("day-text", "", "write a plaintext menu file for each day, like 2024-04-15.txt, to this directory (for signage)")
+	weeks := flag.Bool("weeks", false, "write a Markdown digest of the meals, a section for each week, to a .weeks.md next to the CSVs")
+	weekStart := flag.String("week-start", "monday", "first day of the weeks for -weeks, e.g. monday or sun")
+	warningsCSV := flag.Bool("warnings-csv", false, "write where each PDF's meals couldn't be read for sure to a .warnings.csv next to the CSVs")
+	corrections := flag.String("corrections", "", "JSON file of corrected items or calories by date and meal type, applied to the parsed meals")
+	mealsDB := flag.String("meals-db", "", "upsert the meals parsed from each PDF's tables into this SQLite database")
+	closedTokens := flag.String("closed-tokens", strings.Join(defaultClosedTokens, ","), "comma-separated meal cell texts that mean the cafeteria is closed, for -meals and -meals-db")
+	roundCalories := flag.Bool("round-calories", false, "round the meals' calories to the nearest 10 kcal for -meals and -meals-db (default as on the menu)")
+	summaryLevel := flag.Int("summary", 0, "write a .summary.txt of this describe level next to the CSVs (0 = off)")
+	skipUnchanged := flag.Bool("skip-unchanged", false, "don't rewrite CSV files whose content hasn't changed")
+	grep := flag.String("grep", "", "only write tables containing this keyword")
+	minFreeMB := flag.Uint64("min-free-mb", 100, "minimum free disk space in MB required before downloading (0 = no check)")
+	titleInName := flag.Bool("title-names", false, "add the menu title from the first page to the CSV file names")
+	keepEmpty := flag.Bool("keep-empty", false, "debug: write every extracted table, including empty and undersized ones")
+	runTimeout := flag.Duration("run-timeout", 0, "abort the whole run after this long, keeping files already written (0 = no limit)")
+	allowStaleHTML := flag.Duration("allow-stale-html", 0, "re-download the cached menu HTML once it is older than this (0 = always use the cache)")
+	thisMonth := flag.Bool("this-month", false, "only download the PDF whose link refers to the current month (or -month)")
+	htmlMonthFormat := flag.String("html-month-format", defaultHTMLMonthFormat, "Go time layout of the month in the cached menu HTML file name html/ryoushoku<month>.html")
+	lookAheadDays := flag.Int("look-ahead-days", 0, "fetch next month's menu once it starts within this many days, e.g. 5 fetches January's from December 27 (0 = the current month)")
+	monthFlag := flag.String("month", "", "month to fetch the menu for, as a name (April, apr) or number (4); the latest such month up to next month (default the current month)")
+	startAt := flag.Int("start-at", 1, "resume extraction from this file (1-offset) of the sorted PDF list")
+	snapshotDir := flag.String("snapshots", "", "work offline: read links from ryoushoku*.html snapshots in this directory and extract the PDFs already under PDF/")
+	upload := flag.Bool("upload", false, "upload the CSV directory to the S3-compatible bucket configured by S3_* and AWS_* environment variables")
+	onlyNew := flag.Bool("only-new", false, "only download and extract linked PDFs that aren't already under PDF/")
+	flag.BoolVar(&showProgress, "progress", false, "log the progress of each download")
+	downloadWorkers := flag.Int("download-workers", defaultDownloadWorkers, "number of PDFs to download at a time")
+	referer := flag.String("referer", "", "Referer header sent with PDF requests (default the menu page URL)")
+	offline := flag.Bool("offline", false, "don't touch the network: extract the PDFs already under PDF/")
+	flag.BoolVar(offline, "no-pdf", false, "same as -offline")
+	flag.IntVar(&downloadAttempts, "download-attempts", downloadAttempts, "times to try each download on network errors, 5xx and 429 responses")
+	sinceLastRun := flag.Bool("since-last-run", false, "exit early if the menu page hasn't changed since the last successful run with this flag")
+	strict := flag.Bool("strict", false, "fail if no tables are extracted")
+	cropBox := flag.Bool("crop-box", false, "only extract text inside each page's crop box")
+	annotations := flag.Bool("annotations", false, "also extract the text of PDF annotations")
+	noDocTags := flag.Bool("no-doc-tags", false, "ignore the PDF's structure tags when detecting tables")
+	maxPageBytes := flag.Int("max-page-bytes", 0, "skip pages with more than this many bytes of content (0 = no limit)")
+	memProfile := flag.Bool("profile-mem", false, "write a heap profile to mem.profile at the end of the run")
+	monthFromContent := flag.Bool("month-from-content", false, "file each PDF's CSVs under the year/month printed on its first page instead of the one in its file name")
+	tracePage := flag.Int("trace-page", 0, "debug: trace-log this page number only and dump its raw extractor tables next to the CSVs (0 = off)")
+	setupHTTP := httpFlags(flag.CommandLine)
+	makeUsage(commandUsage + "\n" + exitCodeUsage)
+	flag.Parse()
+	if err := setupHTTP(); err != nil {
+		return err
+	}
+
+	if *lookAheadDays < 0 {
+		return fmt.Errorf("-look-ahead-days must not be negative, got %d", *lookAheadDays)
+	}
+	fetchMonth := menuMonthAt(time.Now(), *lookAheadDays)
+	if *monthFlag != "" {
+		month, err := parseMonth(*monthFlag)
+		if err != nil {
+			return fmt.Errorf("-month: %w", err)
+		}
+		fetchMonth = recentMonth(time.Now(), month)
+	}
+	firstWeekday := time.Monday
+	if *weekStart != "" {
+		day, err := parseWeekday(*weekStart)
+		if err != nil {
+			return fmt.Errorf("-week-start: %w", err)
+		}
+		firstWeekday = day
+	}
+	if err := checkMonthFormat(*htmlMonthFormat); err != nil {
+		return fmt.Errorf("-html-month-format: %w", err)
+	}
+
+	runID := setupRunID()
+
+	if err := InitLicense(); err != nil {
+		return err
+	}
+
+	ctx, cancel := withRunTimeout(context.Background(), *runTimeout)
+	defer cancel()
+	defer func() { runErr = deadlineError(ctx, *runTimeout, runErr) }()
+	// Ctrl+C cancels in-flight downloads cleanly. downloadCtx is separate so that stop() after the
+	// downloads doesn't cancel ctx.
+	downloadCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if err := checkFreeSpace(*workDir, *minFreeMB); err != nil {
+		return err
+	}
+	var s3cfg s3Config
+	if *upload {
+		var err error
+		if s3cfg, err = s3ConfigFromEnv(); err != nil {
+			return err
+		}
+	}
+
+	startedAt := time.Now()
+	paths := newWorkPaths(*workDir, *csvDirFlag)
 	url := "https://www.off.niihama-nct.ac.jp/gakuryo-a/kondate/"
-	nowMonth := getNowManth()
-	filepath := "html/ryoushoku" + nowMonth + ".html"
-	fileInfos, err := ioutil.ReadFile(filepath)
+	var localPDFFilePath []string
+	var sourceURLs map[string]string
+	var menuHTMLPath string // cached menu page, if it was fetched
+	var downloadErr error   // PDFs that failed to download while others didn't
+	var err error
+	if *offline {
+		localPDFFilePath, err = localPDFPaths(paths.PDF)
+	} else if *snapshotDir != "" {
+		localPDFFilePath, sourceURLs, err = snapshotPDFPaths(*snapshotDir, url, paths.PDF)
+	} else {
+		htmlPath := filepath.Join(paths.html, "ryoushoku"+htmlMonth(fetchMonth, *htmlMonthFormat)+".html")
+		if *sinceLastRun {
+			prevRun, err := readLastRun(paths.lastRun)
+			if err != nil {
+				return err
+			}
+			changed, err := menuChangedSince(downloadCtx, url+"ryoushoku.html", htmlPath, prevRun)
+			if err != nil {
+				return fmt.Errorf("checking the menu page: %w", err)
+			}
+			if !changed {
+				log.Printf("No changes since the last run at %s", prevRun.at.Format(time.RFC3339))
+				return nil
+			}
+		}
+		menuHTMLPath = htmlPath
+		localPDFFilePath, sourceURLs, err = downloadMenuPDFs(downloadCtx, url, htmlPath, paths.PDF, fetchOptions{
+			maxAge:    *allowStaleHTML,
+			thisMonth: *thisMonth,
+			month:     fetchMonth,
+			onlyNew:   *onlyNew,
+			referer:   *referer,
+			workers:   *downloadWorkers,
+		})
+		// Carry on with the PDFs that did download unless the run was interrupted, and report the
+		// failures once they are extracted.
+		if err != nil && len(localPDFFilePath) > 0 && downloadCtx.Err() == nil {
+			log.Printf("warning: some PDFs failed to download, extracting the %d that did: %v", len(localPDFFilePath), err)
+			downloadErr, err = err, nil
+		}
+	}
 	if err != nil {
-		log.Println("Downloading Domitory Meal HTML File...")
-		err = DownloadFile(filepath, url+"ryoushoku.html")
+		return fmt.Errorf("getting the menu PDFs: %w", err)
 	}
+	// Downloads are done; let Ctrl+C stop the rest of the run as usual.
+	stop()
+	if *onlyNew && len(localPDFFilePath) == 0 {
+		log.Println("No new PDFs to download")
+		return nil
+	}
+
+	localPDFFilePath, err = uniqueByContent(localPDFFilePath)
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+
+	outDir := paths.csv
+	// With -this-month the menu's year is known, which the site's year directory may not match
+	// around New Year.
+	csvRootFunc := CSVRootFunc(nil)
+	if *thisMonth {
+		csvRootFunc = CSVRootFunc(menuCSVRoot(outDir, fetchMonth))
+	}
+	if len(localPDFFilePath) == 0 {
+		return fmt.Errorf("%w: PDFFilePath is empty", errNoMenu)
+	} else {
+		err = extractPDF(ctx, localPDFFilePath,
+			csvDir(outDir),
+			csvRootFunc,
+			FirstPage(*firstPage),
+			LastPage(*lastPage),
+			Width(*width),
+			Height(*height),
+			Verbose(*verbose),
+			Debug(*debug),
+			Trace(*trace),
+			DoProfile(*doProfile),
+			MergeRows(*mergeRows),
+			CellJoin(*cellJoin),
+			SummaryLevel(*summaryLevel),
+			MealsJSON(*mealsJSON),
+			JSONPretty(*jsonPretty),
+			MealsDB(*mealsDB),
+			DayTextDir(*dayTextDir),
+			Weeks(*weeks, firstWeekday),
+			WarningsCSV(*warningsCSV),
+			CorrectionsFile(*corrections),
+			ClosedTokens(splitTokens(*closedTokens)),
+			RoundCalories(*roundCalories),
+			SkipUnchanged(*skipUnchanged),
+			Grep(*grep),
+			TitleInName(*titleInName),
+			KeepEmpty(*keepEmpty),
+			Strict(*strict),
+			StartAt(*startAt),
+			SourceURLs(sourceURLs),
+			TracePage(*tracePage),
+			MonthFromContent(*monthFromContent),
+			MemProfile(*memProfile),
+			MaxPageBytes(*maxPageBytes),
+			RunID(runID),
+			ApplyCropBox(*cropBox),
+			IncludeAnnotations(*annotations),
+			DisableDocumentTags(*noDocTags),
+		)
+		if err != nil {
+			return fmt.Errorf("extracting tables: %w", err)
+		}
 	}
-	remotePDFFilePath, err := getPDFFilePath(&fileInfos)
+
+	if *upload {
+		if err := uploadOutputs(ctx, s3cfg, outDir); err != nil {
+			return fmt.Errorf("uploading: %w", err)
+		}
+	}
+	if downloadErr != nil {
+		// Not recorded as the last run, so the next -since-last-run run retries the failed PDFs.
+		return fmt.Errorf("%w: %w", errPartial, downloadErr)
+	}
+	if *sinceLastRun {
+		run := lastRun{at: startedAt}
+		if menuHTMLPath != "" {
+			// The page this run extracted, so an unchanged page is skipped next time.
+			if run.pageHash, err = fileSHA256(menuHTMLPath); err != nil {
+				return err
+			}
+		}
+		if err := writeLastRun(paths.lastRun, run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workPaths are where a run keeps its files under its -work-dir.
+type workPaths struct {
+	html    string // cached menu pages
+	PDF     string // downloaded menu PDFs
+	csv     string // extracted CSVs and the other outputs
+	lastRun string // -since-last-run state file
+}
+
+// newWorkPaths returns the paths under `workDir`, with the CSVs in `csvDir` if it isn't "".
+func newWorkPaths(workDir, csvDir string) workPaths {
+	paths := workPaths{
+		html:    filepath.Join(workDir, "html"),
+		PDF:     filepath.Join(workDir, "PDF"),
+		csv:     csvDir,
+		lastRun: filepath.Join(workDir, lastRunFile),
+	}
+	if paths.csv == "" {
+		paths.csv = filepath.Join(workDir, "outcsv")
+	}
+	return paths
+}
+
+// fetchOptions controls which menu PDFs downloadMenuPDFs fetches.
+type fetchOptions struct {
+	maxAge    time.Duration // re-download the cached menu page once it is older than this
+	thisMonth bool          // only the PDF for month
+	month     time.Time     // the month being fetched
+	onlyNew   bool          // only PDFs that aren't already under PDFRoot
+	referer   string        // Referer sent with PDF requests; "" means the menu page
+	workers   int           // number of PDFs to download at a time
+}
+
+// downloadMenuPDFs loads the menu page at `url` (cached at `htmlPath`) and downloads the PDFs it
+// links to under `PDFRoot`. It returns the local paths of the PDFs and a map from each local path
+// to the URL it was downloaded from.
+func downloadMenuPDFs(ctx context.Context, url, htmlPath, PDFRoot string, fetch fetchOptions) ([]string, map[string]string, error) {
+	menuURL := url + "ryoushoku.html"
+	fileInfos, err := loadMenuHTML(ctx, htmlPath, menuURL, fetch.maxAge)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, nil, err
+	}
+	links, err := getPDFLinks(&fileInfos)
+	if err != nil {
+		return nil, nil, err
+	}
+	remotePDFFilePath := pdfLinkPaths(links)
+	if fetch.thisMonth {
+		remotePDFFilePath = selectMonthLinks(links, fetch.month)
+	}
+	if len(remotePDFFilePath) == 0 {
+		return nil, nil, fmt.Errorf("%w: no PDF links on %s", errNoMenu, url)
+	}
+	if fetch.onlyNew {
+		missing := missingPDFPaths(url, remotePDFFilePath, PDFRoot)
+		log.Printf("%d of %d linked PDFs are new", len(missing), len(remotePDFFilePath))
+		remotePDFFilePath = missing
 	}
 
-	// Download PDF Files to ./PDF
-	first := true
-	var localPDFFilePath []string
-	PDFRoot := "PDF/"
+	// The server may refuse PDF requests that don't come from the menu page.
+	referer := fetch.referer
+	if referer == "" {
+		referer = menuURL
+	}
+
+	// Download PDF Files to ./PDF. The directories are made here, before the downloads start, so
+	// that the workers don't race to create them. A PDF linked more than once is downloaded once,
+	// since two workers writing the same file would corrupt it.
+	var jobs []downloadJob
+	madeDirs := make(map[string]bool)
+	seen := make(map[string]bool)
 	for _, remotePDFPath := range remotePDFFilePath {
-		PDFUrl, isUrl := makeFullPath(url, remotePDFPath)
-		if isUrl {
+		PDFUrl, relPath := makeFullPath(url, remotePDFPath)
+		localPath, err := localPDFPath(PDFRoot, relPath)
+		if err != nil {
+			log.Printf("warning: skipping link %q: %v", remotePDFPath, err)
 			continue
 		}
-		direcoryName, err := getDirecotry(remotePDFPath)
-		localPDFFilePath = append(localPDFFilePath, PDFRoot+remotePDFPath)
+		direcoryName, err := getDirecotry(relPath)
 		if err != nil {
-			log.Fatalln(err)
+			return nil, nil, err
 		}
-		if first {
-			first = false
-			err = makeDirecoty(PDFRoot + direcoryName)
-			if err != nil {
-				log.Fatalln(err)
+		if seen[localPath] {
+			continue
+		}
+		seen[localPath] = true
+		jobs = append(jobs, downloadJob{localPath: localPath, url: PDFUrl})
+		if dir := filepath.Join(PDFRoot, direcoryName); !madeDirs[dir] {
+			madeDirs[dir] = true
+			if err := makeDirecoty(dir); err != nil {
+				return nil, nil, err
 			}
 		}
-		err = DownloadFile(PDFRoot+remotePDFPath, PDFUrl)
+	}
+
+	errs := downloadAll(ctx, jobs, referer, fetch.workers)
+	var localPDFFilePath []string
+	sourceURLs := make(map[string]string)
+	for i, job := range jobs {
+		if errs[i] != nil {
+			continue
+		}
+		localPDFFilePath = append(localPDFFilePath, job.localPath)
+		sourceURLs[job.localPath] = job.url
+	}
+	return localPDFFilePath, sourceURLs, errors.Join(errs...)
+}
+
+// downloadJob is a file for downloadAll to download.
+type downloadJob struct {
+	localPath string
+	url       string
+}
+
+// defaultDownloadWorkers is the default number of concurrent PDF downloads.
+const defaultDownloadWorkers = 4
+
+// downloadAll downloads `jobs` with up to `workers` downloads at a time. It returns the error, if
+// any, for each job at the same index. A failed job doesn't stop the others.
+func downloadAll(ctx context.Context, jobs []downloadJob, referer string, workers int) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = DownloadFileWithRetry(ctx, jobs[i].localPath, jobs[i].url, referer, downloadAttempts)
+				if errs[i] != nil {
+					log.Printf("Failed to download %s: %v", jobs[i].url, errs[i])
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+// missingPDFPaths returns the PDF links in `remotePDFFilePath`, relative to `url`, whose files
+// don't exist under `PDFRoot` yet.
+func missingPDFPaths(url string, remotePDFFilePath []string, PDFRoot string) []string {
+	var missing []string
+	for _, remotePDFPath := range remotePDFFilePath {
+		_, relPath := makeFullPath(url, remotePDFPath)
+		localPath, err := localPDFPath(PDFRoot, relPath)
 		if err != nil {
-			log.Fatalln(err)
+			log.Printf("warning: skipping link %q: %v", remotePDFPath, err)
+			continue
+		}
+		if _, err := os.Stat(localPath); os.IsNotExist(err) {
+			missing = append(missing, remotePDFPath)
 		}
+	}
+	return missing
+}
 
+// withRunTimeout returns a context derived from `parent` that expires after `timeout`, or never
+// expires if `timeout` isn't positive.
+func withRunTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
 	}
+	return context.WithTimeout(parent, timeout)
+}
 
-	//TODO: これをここで使えるようにする
-	if len(localPDFFilePath) == 0 {
-		log.Fatalln("PDFFilePath is empty")
-	} else {
-		err = extractPDF(localPDFFilePath)
+// deadlineError returns `err` wrapped with errRunDeadline if `ctx`, made by withRunTimeout with
+// `timeout`, has hit its deadline, since `err` is then most likely a result of that. Files that
+// were completely written before then are left in place.
+func deadlineError(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w after %s, keeping partial results: %w", errRunDeadline, timeout, err)
+}
+
+// downloadAttempts is the number of times a download is attempted before giving up. It is set by
+// -download-attempts.
+var downloadAttempts = 3
+
+// minHTMLSize is the smallest menu page size we accept as a complete download.
+const minHTMLSize = 512
+
+// loadMenuHTML returns the contents of the menu page cached at `htmlPath`, downloading it from
+// `url` if it isn't cached or, when `maxAge` is positive, if the cached copy is older than
+// `maxAge`. A cached page that looks truncated is re-downloaded once. If it still looks
+// truncated, it is returned with a warning, since a complete HTML5 page may leave out </html>.
+func loadMenuHTML(ctx context.Context, htmlPath string, url string, maxAge time.Duration) ([]byte, error) {
+	if maxAge > 0 {
+		if fi, err := os.Stat(htmlPath); err == nil && time.Since(fi.ModTime()) > maxAge {
+			log.Printf("%s: cached copy is older than %s, re-downloading", htmlPath, maxAge)
+			if err := refreshMenuHTML(ctx, htmlPath, url); err != nil {
+				log.Printf("warning: %s: re-downloading failed, using the stale copy: %v", htmlPath, err)
+			}
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if _, err := os.Stat(htmlPath); os.IsNotExist(err) {
+			log.Println("Downloading Domitory Meal HTML File...")
+			if err := DownloadFileWithRetry(ctx, htmlPath, url, "", downloadAttempts); err != nil {
+				return nil, err
+			}
+		}
+		fileInfos, err := ioutil.ReadFile(htmlPath)
 		if err != nil {
-			log.Fatalln(err)
+			return nil, err
+		}
+		if !looksTruncated(fileInfos) {
+			return fileInfos, nil
+		}
+		if attempt > 0 {
+			log.Printf("warning: %s: still looks truncated after re-downloading (%d bytes), parsing it anyway",
+				htmlPath, len(fileInfos))
+			return fileInfos, nil
+		}
+		log.Printf("%s: looks truncated (%d bytes), re-downloading", htmlPath, len(fileInfos))
+		if err := os.Remove(htmlPath); err != nil {
+			return nil, err
 		}
 	}
+}
 
+// refreshMenuHTML re-downloads the menu page at `url` over the copy cached at `htmlPath`. The page
+// is downloaded next to it and only replaces it once complete and not truncated, so a failed
+// download leaves the cached copy in place.
+func refreshMenuHTML(ctx context.Context, htmlPath string, url string) error {
+	newPath := htmlPath + ".new"
+	// DownloadFile keeps an existing file, so drop one left by an interrupted refresh.
+	if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := DownloadFileWithRetry(ctx, newPath, url, "", downloadAttempts); err != nil {
+		return err
+	}
+	html, err := ioutil.ReadFile(newPath)
+	if err != nil {
+		return err
+	}
+	if looksTruncated(html) {
+		os.Remove(newPath)
+		return fmt.Errorf("download looks truncated (%d bytes)", len(html))
+	}
+	return os.Rename(newPath, htmlPath)
+}
+
+// looksTruncated returns true if `html` is too small or doesn't end with a closing </html> tag.
+func looksTruncated(html []byte) bool {
+	if len(html) < minHTMLSize {
+		return true
+	}
+	trimmed := bytes.TrimSpace(html)
+	return !bytes.HasSuffix(bytes.ToLower(trimmed), []byte("</html>"))
 }
 
-func DownloadFile(filepath string, url string) error {
+// DownloadFile downloads `url` to `localPath` unless that already exists. A non-empty `referer`
+// is sent as the Referer header. The request is abandoned when `ctx` is done.
+//
+// The download is written to <localPath>.part and renamed to `localPath` once complete, so that a
+// killed run never leaves a truncated file that looks already downloaded. If a .part file is left
+// from an interrupted download, only the rest of the file is requested with a Range header and
+// appended to it. A server that ignores the Range gets a full re-download.
+//
+// A `localPath` ending in .pdf must get a PDF: a response without the %PDF- header, like an HTML
+// error page served with status 200, is rejected with an error naming its Content-Type.
+func DownloadFile(ctx context.Context, localPath string, url string, referer string) error {
 	// Check if file already exists
-	if _, err := os.Stat(filepath); !os.IsNotExist(err) {
-		log.Println(filepath + ": already exists")
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		log.Println(localPath + ": already exists")
 		return nil
 	}
+	partPath := localPath + ".part"
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// Ranges are of the encoded body, so ask for it unencoded to be able to append.
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &tooManyRequestsError{url: url, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	if offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// The partial file doesn't match what the server has now. Start again.
+		log.Printf("%s: can't resume from %d bytes, downloading it again", localPath, offset)
+		resp.Body.Close()
+		if err := os.Remove(partPath); err != nil {
+			return err
+		}
+		return DownloadFile(ctx, localPath, url, referer)
+	}
+	// Don't save an error page, e.g. a 404 for a PDF that has been removed, as the file.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &httpStatusError{url: url, statusCode: resp.StatusCode, status: resp.Status}
+	}
+	resume := offset > 0 && resp.StatusCode == http.StatusPartialContent
+	if resume {
+		if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+			os.Remove(partPath)
+			return fmt.Errorf("%s: can't resume a download with Content-Encoding %q", url, enc)
+		}
+		log.Printf("%s: resuming from %d bytes", localPath, offset)
+	}
 
-	out, err := os.Create(filepath)
+	if showProgress {
+		// Wrapped before decoding, so that bytes read are counted against Content-Length.
+		resp.Body = newProgressReader(resp.Body, localPath, resp.ContentLength)
+	}
+	body, err := decodedBody(resp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	defer body.Close()
+	var src io.Reader = body
+	// A resumed download starts part way through the file, so it can't be checked here.
+	if strings.EqualFold(filepath.Ext(localPath), ".pdf") && !resume {
+		br := bufio.NewReader(body)
+		head, _ := br.Peek(pdfHeaderWindow)
+		if !bytes.Contains(head, []byte("%PDF-")) {
+			return fmt.Errorf("%s: not a PDF (Content-Type %q, starts %q)",
+				url, resp.Header.Get("Content-Type"), truncateBytes(head, 32))
+		}
+		src = br
+	}
+
+	// Create the parent directory, e.g. html/ on a first run, rather than failing in os.Create.
+	if err := makeDirecoty(filepath.Dir(localPath)); err != nil {
+		return err
+	}
+	var out *os.File
+	if resume {
+		out, err = os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0666)
+	} else {
+		out, err = os.Create(partPath)
+	}
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	// Only a complete file ever appears at localPath. A transfer cut off by the network or ctx
+	// leaves the .part file to be resumed next time; any other failure removes it.
+	dst := &recordingWriter{w: out}
+	if _, err := io.Copy(dst, src); err != nil {
+		if dst.err != nil {
+			out.Close()
+			os.Remove(partPath)
+		}
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	return nil
+}
+
+// recordingWriter is an io.Writer that records the last error from writing to `w`, so that
+// write failures can be told apart from read failures after io.Copy.
+type recordingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	n, err := rw.w.Write(p)
+	if err != nil {
+		rw.err = err
+	}
+	return n, err
+}
+
+// pdfHeaderWindow is how far into a file the %PDF- header is looked for. Some writers put junk
+// before it, and readers accept it within the first 1024 bytes.
+const pdfHeaderWindow = 1024
+
+// truncateBytes returns at most the first `n` bytes of `b`.
+func truncateBytes(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
+
+// decodedBody returns the body of `resp` with any gzip or deflate Content-Encoding removed. The
+// default transport only does this itself when it was the one that asked for gzip, so a server
+// that compresses unasked, or uses deflate, would otherwise leave compressed bytes on disk.
+func decodedBody(resp *http.Response) (io.ReadCloser, error) {
+	if resp.Uncompressed {
+		return io.NopCloser(resp.Body), nil
+	}
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return io.NopCloser(resp.Body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// "deflate" should be zlib-wrapped but some servers send a raw deflate stream.
+		br := bufio.NewReader(resp.Body)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+// isZlibHeader returns true if `header` is a valid 2-byte zlib stream header.
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// Waits between DownloadFileWithRetry attempts. Network errors and 5xx responses back off
+// exponentially from baseBackoff.
+const (
+	defaultRetryWait = 5 * time.Second
+	maxRetryWait     = 5 * time.Minute
+	baseBackoff      = 1 * time.Second
+)
+
+// tooManyRequestsError is returned by DownloadFile when the server responds 429 Too Many Requests.
+// retryAfter is the wait requested by the server's Retry-After header, or 0 if it didn't send one.
+type tooManyRequestsError struct {
+	url        string
+	retryAfter time.Duration
+}
+
+func (e *tooManyRequestsError) Error() string {
+	return fmt.Sprintf("%s: 429 Too Many Requests (Retry-After %s)", e.url, e.retryAfter)
+}
+
+// httpStatusError is returned by DownloadFile when the server responds with a non-2xx status
+// other than 429.
+type httpStatusError struct {
+	url        string
+	statusCode int
+	status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected HTTP status %s", e.url, e.status)
+}
+
+// DownloadFileWithRetry calls DownloadFile up to `attempts` times, sleeping between attempts after
+// errors that may be transient. When the server is throttling us its Retry-After is honoured
+// (capped at maxRetryWait) and defaultRetryWait is used when it doesn't send one. Network errors
+// and 5xx responses are retried with exponential backoff. Other errors, like a 404, aren't retried.
+func DownloadFileWithRetry(ctx context.Context, filepath string, url string, referer string, attempts int) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = DownloadFile(ctx, filepath, url, referer)
+		if err == nil || ctx.Err() != nil || attempt == attempts {
+			return err
+		}
+		wait, ok := retryWait(err, attempt)
+		if !ok {
+			return err
+		}
+		log.Printf("%v: retrying in %s (attempt %d of %d)", err, wait, attempt+1, attempts)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return err
 }
 
-func makeFullPath(url string, path string) (string, bool) {
-	if isUrl := strings.Contains(path, "://"); isUrl {
-		return "", isUrl
-	} else {
-		return url + path, isUrl
+// retryWait returns how long to wait before retrying a download that failed with `err` on
+// (1-offset) attempt `attempt`. ok is false if `err` isn't worth retrying.
+func retryWait(err error, attempt int) (wait time.Duration, ok bool) {
+	var throttled *tooManyRequestsError
+	var status *httpStatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &throttled):
+		wait = throttled.retryAfter
+		if wait <= 0 {
+			wait = defaultRetryWait
+		}
+	case errors.As(err, &status) && status.statusCode >= 500:
+		wait = baseBackoff << (attempt - 1)
+	case errors.As(err, &netErr):
+		wait = baseBackoff << (attempt - 1)
+	default:
+		return 0, false
+	}
+	if wait > maxRetryWait || wait <= 0 {
+		wait = maxRetryWait
+	}
+	return wait, true
+}
+
+// parseRetryAfter returns the wait given by Retry-After header value `value`, which may be either
+// a number of seconds or an HTTP-date. It returns 0 if `value` is empty or can't be parsed.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
 	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil && when.After(now) {
+		return when.Sub(now)
+	}
+	return 0
 }
 
-func getPDFFilePath(readedFile *[]byte) ([]string, error) {
-	if len(*readedFile) == 0 {
-		return nil, fmt.Errorf("readedFile is empty")
+// makeFullPath returns link `href` resolved against base URL `baseURL`, leaving absolute URLs
+// unchanged, and the slash-separated path to save it under. That is the link's path relative to
+// `baseURL`, or its host and path if it points elsewhere.
+func makeFullPath(baseURL string, href string) (string, string) {
+	base, err := neturl.Parse(baseURL)
+	if err != nil {
+		return baseURL + href, href
 	}
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(*readedFile))
+	ref, err := neturl.Parse(href)
 	if err != nil {
-		return nil, err
+		return baseURL + href, href
 	}
-	var links []string
-	doc.Find("tbody > tr").Each(func(_ int, row *goquery.Selection) {
-		path, exists := row.Find("a").Attr("href")
-		if !exists {
-			return
+	full := base.ResolveReference(ref)
+	if full.Host == base.Host && strings.HasPrefix(full.Path, base.Path) {
+		return full.String(), strings.TrimPrefix(full.Path, base.Path)
+	}
+	return full.String(), full.Host + full.Path
+}
+
+// localPDFPath returns the local path under `PDFRoot` that slash-separated `relPath`, from
+// makeFullPath, is saved to. It returns an error if the path would be outside `PDFRoot`, as for a
+// link with percent-encoded dots like "%2e%2e/%2e%2e/tmp/evil.pdf", which URL resolution leaves in.
+func localPDFPath(PDFRoot, relPath string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(relPath))
+	if rel == "." || rel == ".." || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) || strings.HasPrefix(rel, string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the PDF directory", relPath)
+	}
+	return filepath.Join(PDFRoot, rel), nil
+}
+
+// defaultHTMLMonthFormat is the default time layout of the month in the cached menu HTML file
+// name. It is numeric like the site's own paths, and includes the year so that a cache from the
+// same month of an earlier year is never reused.
+const defaultHTMLMonthFormat = "200601"
+
+// htmlMonth returns the month of `t` formatted with time layout `layout`, for the name of the
+// cached menu HTML file.
+func htmlMonth(t time.Time, layout string) string {
+	return t.Format(layout)
+}
+
+// checkMonthFormat returns an error if time layout `layout` doesn't tell the months apart, which
+// would make every month share one cached HTML file.
+func checkMonthFormat(layout string) error {
+	seen := make(map[string]bool)
+	for month := time.January; month <= time.December; month++ {
+		name := htmlMonth(time.Date(2000, month, 1, 0, 0, 0, 0, time.UTC), layout)
+		if seen[name] || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("%q must contain a month and no path separators", layout)
 		}
-		if len(path) > 0 {
-			links = append(links, path)
+		seen[name] = true
+	}
+	return nil
+}
+
+// menuMonthAt returns the first day of the month whose menu to fetch at time `now`: the current
+// month, or the next one once it starts within `lookAheadDays` days.
+func menuMonthAt(now time.Time, lookAheadDays int) time.Time {
+	t := now.AddDate(0, 0, lookAheadDays)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// recentMonth returns the first day of the latest `month` up to the month after `now`. The month
+// after is included because its menu is published before it starts: in December, January is next
+// month's, but otherwise a month later in the year than `now` is last year's, so that in October
+// January means this January and December last December.
+func recentMonth(now time.Time, month time.Month) time.Time {
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	if month == next.Month() {
+		return next
+	}
+	year := now.Year()
+	if month > now.Month() {
+		year--
+	}
+	return time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+}
+
+// splitTokens returns the comma-separated tokens in `list`, normalized like the table cells they
+// are compared with. Empty tokens are dropped.
+func splitTokens(list string) []string {
+	tokens := []string{}
+	for _, token := range strings.Split(list, ",") {
+		if token = normalize(token); token != "" {
+			tokens = append(tokens, token)
 		}
-	})
-	return links, nil
+	}
+	return tokens
 }
 
-func getNowManth() string {
-	return time.Now().Month().String()
+// parseMonth parses month `s`, given as an English month name or its first three or more letters
+// ("April", "apr") or as a number from 1 to 12, optionally followed by 月 ("4", "04", "4月").
+func parseMonth(s string) (time.Month, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(strings.TrimSuffix(name, "月")); err == nil {
+		if n < 1 || n > 12 {
+			return 0, fmt.Errorf("month number %d is not between 1 and 12", n)
+		}
+		return time.Month(n), nil
+	}
+	if len(name) >= 3 {
+		for month := time.January; month <= time.December; month++ {
+			if strings.HasPrefix(strings.ToLower(month.String()), name) {
+				return month, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%q is not a month name or number", s)
 }
 
+// getDirecotry returns the directory part of relative slash-separated path `filePath`, with all
+// its levels, e.g. "2024/04" for "2024/04/menu.pdf" and "." for "menu.pdf".
 func getDirecotry(filePath string) (string, error) {
-	parts := strings.Split(filePath, "/")
-	if len(parts) == 0 {
+	if filePath == "" {
 		return "", fmt.Errorf("cannot get directory")
 	}
-	return parts[0], nil
+	return filepath.Dir(filepath.FromSlash(filePath)), nil
 }
 
 func makeDirecoty(direcoryName string) error {
@@ -0,0 +1,914 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// menuPage returns a menu page with a table row linking to each of `hrefs`, padded to more than
+// minHTMLSize so that it doesn't look truncated.
+func menuPage(hrefs ...string) string {
+	var b strings.Builder
+	b.WriteString("<html><body><table><tbody>\n")
+	for _, href := range hrefs {
+		fmt.Fprintf(&b, "<tr><td><a href=%q>%s</a></td></tr>\n", href, href)
+	}
+	b.WriteString("</tbody></table>\n<!--" + strings.Repeat(" ", minHTMLSize) + "-->\n</body></html>\n")
+	return b.String()
+}
+
+// captureLog sends the log output to the returned buffer until the end of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	b := new(bytes.Buffer)
+	out, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(b)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	})
+	return b
+}
+
+// fakePDF is the body served for PDFs by menuServer.
+const fakePDF = "%PDF-1.4\n% fake menu\n"
+
+// menuServer is a stub of the menu site. It serves `page` as the menu page and fakePDF for every
+// other path, and counts the requests for each path.
+type menuServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+	headers  map[string]http.Header // headers of the last request for each path
+}
+
+func newMenuServer(t *testing.T, page string) *menuServer {
+	s := &menuServer{requests: make(map[string]int), headers: make(map[string]http.Header)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.headers[r.URL.Path] = r.Header.Clone()
+		s.mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/ryoushoku.html") {
+			fmt.Fprint(w, page)
+			return
+		}
+		fmt.Fprint(w, fakePDF)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// count returns the number of requests for `path`.
+func (s *menuServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// header returns header `key` of the last request for `path`.
+func (s *menuServer) header(path, key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[path].Get(key)
+}
+
+func TestDownloadMenuPDFsDownloadsDuplicateLinksOnce(t *testing.T) {
+	srv := newMenuServer(t, menuPage("2024PDF/apr.pdf", "2024PDF/apr.pdf", "./2024PDF/apr.pdf", "2024PDF/may.pdf"))
+	dir := t.TempDir()
+	paths, _, err := downloadMenuPDFs(context.Background(), srv.URL+"/kondate/",
+		filepath.Join(dir, "menu.html"), filepath.Join(dir, "PDF"), fetchOptions{workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("got %d local paths %q, want 2", len(paths), paths)
+	}
+	if n := srv.count("/kondate/2024PDF/apr.pdf"); n != 1 {
+		t.Errorf("apr.pdf requested %d times, want 1", n)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "PDF", "2024PDF", "apr.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != fakePDF {
+		t.Errorf("apr.pdf = %q, want %q", got, fakePDF)
+	}
+}
+
+func TestDownloadMenuPDFsSendsReferer(t *testing.T) {
+	tests := []struct {
+		name    string
+		referer string
+		want    string // "" means the menu page URL
+	}{
+		{"menu page by default", "", ""},
+		{"-referer", "https://example.com/kondate/", "https://example.com/kondate/"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newMenuServer(t, menuPage("2024PDF/apr.pdf", "2024PDF/may.pdf"))
+			want := tc.want
+			if want == "" {
+				want = srv.URL + "/kondate/ryoushoku.html"
+			}
+			dir := t.TempDir()
+			_, _, err := downloadMenuPDFs(context.Background(), srv.URL+"/kondate/",
+				filepath.Join(dir, "menu.html"), filepath.Join(dir, "PDF"), fetchOptions{referer: tc.referer, workers: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range []string{"/kondate/2024PDF/apr.pdf", "/kondate/2024PDF/may.pdf"} {
+				if got := srv.header(path, "Referer"); got != want {
+					t.Errorf("%s: Referer = %q, want %q", path, got, want)
+				}
+			}
+			if got := srv.header("/kondate/ryoushoku.html", "Referer"); got != "" {
+				t.Errorf("menu page sent with Referer %q", got)
+			}
+		})
+	}
+}
+
+func TestLocalPDFPath(t *testing.T) {
+	PDFRoot := filepath.Join("work", "PDF")
+	tests := []struct {
+		relPath string
+		want    string // "" if the path is rejected
+	}{
+		{"2024PDF/apr.pdf", filepath.Join(PDFRoot, "2024PDF", "apr.pdf")},
+		{"example.com/kondate/2024PDF/apr.pdf", filepath.Join(PDFRoot, "example.com", "kondate", "2024PDF", "apr.pdf")},
+		{"2024PDF/../2025PDF/jan.pdf", filepath.Join(PDFRoot, "2025PDF", "jan.pdf")},
+		{"../../../../tmp/evil.pdf", ""},
+		{"2024PDF/../../evil.pdf", ""},
+		{"..", ""},
+		{"/tmp/evil.pdf", ""},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		got, err := localPDFPath(PDFRoot, tc.relPath)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("localPDFPath(%q) = %q, want an error", tc.relPath, got)
+			}
+		} else if err != nil || got != tc.want {
+			t.Errorf("localPDFPath(%q) = %q, %v, want %q", tc.relPath, got, err, tc.want)
+		}
+	}
+}
+
+func TestDownloadMenuPDFsRejectsEncodedDotDot(t *testing.T) {
+	logs := captureLog(t)
+	const evil = "%2e%2e/%2e%2e/%2e%2e/evil.pdf"
+	srv := newMenuServer(t, menuPage(evil, "2024PDF/apr.pdf"))
+	dir := t.TempDir()
+	workDir := filepath.Join(dir, "a", "work")
+	PDFRoot := filepath.Join(workDir, "PDF")
+	paths, _, err := downloadMenuPDFs(context.Background(), srv.URL+"/kondate/",
+		filepath.Join(workDir, "menu.html"), PDFRoot, fetchOptions{workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(PDFRoot, "2024PDF", "apr.pdf")}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("downloadMenuPDFs = %q, want %q", paths, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.pdf")); !os.IsNotExist(err) {
+		t.Errorf("evil.pdf written outside the work directory: %v", err)
+	}
+	if !strings.Contains(logs.String(), "warning: skipping link") {
+		t.Errorf("skipped link not logged: %q", logs.String())
+	}
+
+	if got := missingPDFPaths(srv.URL+"/kondate/", []string{evil}, PDFRoot); len(got) != 0 {
+		t.Errorf("missingPDFPaths = %q, want the link skipped", got)
+	}
+}
+
+func TestMissingPDFPaths(t *testing.T) {
+	PDFRoot := t.TempDir()
+	for _, rel := range []string{"2024PDF/apr.pdf", "2024PDF/may.pdf"} {
+		path := filepath.Join(PDFRoot, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fakePDF), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := []string{"2024PDF/apr.pdf", "./2024PDF/may.pdf", "2024PDF/jun.pdf", "2025PDF/apr.pdf"}
+	got := missingPDFPaths("https://example.com/kondate/", links, PDFRoot)
+	if want := []string{"2024PDF/jun.pdf", "2025PDF/apr.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingPDFPaths = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadMenuPDFsOnlyNew(t *testing.T) {
+	captureLog(t)
+	srv := newMenuServer(t, menuPage("2024PDF/apr.pdf", "2024PDF/may.pdf"))
+	dir := t.TempDir()
+	PDFRoot := filepath.Join(dir, "PDF")
+	have := filepath.Join(PDFRoot, "2024PDF", "apr.pdf")
+	if err := os.MkdirAll(filepath.Dir(have), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(have, []byte(fakePDF), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _, err := downloadMenuPDFs(context.Background(), srv.URL+"/kondate/",
+		filepath.Join(dir, "menu.html"), PDFRoot, fetchOptions{onlyNew: true, workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(PDFRoot, "2024PDF", "may.pdf")}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("downloadMenuPDFs = %q, want %q", paths, want)
+	}
+	if n := srv.count("/kondate/2024PDF/apr.pdf"); n != 0 {
+		t.Errorf("apr.pdf requested %d times, want 0", n)
+	}
+	if n := srv.count("/kondate/2024PDF/may.pdf"); n != 1 {
+		t.Errorf("may.pdf requested %d times, want 1", n)
+	}
+}
+
+func TestWorkDirHoldsAllArtifacts(t *testing.T) {
+	captureLog(t)
+	srv := newMenuServer(t, menuPage("2024PDF/apr.pdf"))
+	base := t.TempDir()
+	// Run from an empty directory, which must stay empty.
+	cwd := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	paths := newWorkPaths(base, "")
+	htmlPath := filepath.Join(paths.html, "ryoushokuApril.html")
+	PDFPaths, _, err := downloadMenuPDFs(context.Background(), srv.URL+"/kondate/", htmlPath, paths.PDF, fetchOptions{workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvRoot, err := defaultCSVRoot(paths.csv)(PDFPaths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := makeDirErr("CSV Sub directory", filepath.Dir(csvRoot)); err != nil {
+		t.Fatal(err)
+	}
+	r := docTables{pageTables: map[int][]stringTable{1: {{{"4/1", "rice"}}}}}
+	if err := r.saveCSVFiles(csvRoot, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{
+		"html/ryoushokuApril.html",
+		"PDF/2024PDF/apr.pdf",
+		"outcsv/2024PDF/apr/apr.page1.table1.csv",
+	} {
+		if _, err := os.Stat(filepath.Join(base, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("%s not under the work dir: %v", rel, err)
+		}
+	}
+	if paths.lastRun != filepath.Join(base, lastRunFile) {
+		t.Errorf("last-run state at %q, want it under the work dir", paths.lastRun)
+	}
+	if entries, err := os.ReadDir(cwd); err != nil || len(entries) > 0 {
+		t.Errorf("current directory has %d entries (err %v), want none", len(entries), err)
+	}
+}
+
+func TestNewWorkPathsCSVDir(t *testing.T) {
+	if got := newWorkPaths("run1", "out").csv; got != "out" {
+		t.Errorf("CSV dir with -csvdir = %q, want %q", got, "out")
+	}
+}
+
+// slowStage stands in for a pipeline stage that takes longer than the run deadline: it returns
+// ctx.Err() once `ctx` is done.
+func slowStage(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(10 * time.Second):
+		return nil
+	}
+}
+
+func TestRunDeadlineStopsSlowStage(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	ctx, cancel := withRunTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := deadlineError(ctx, timeout, slowStage(ctx))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("slow stage ran for %s, want it stopped at the %s deadline", elapsed, timeout)
+	}
+	if !errors.Is(err, errRunDeadline) {
+		t.Errorf("err = %v, want errRunDeadline", err)
+	}
+	if got := exitCode(err); got != exitDeadline {
+		t.Errorf("exitCode(%v) = %d, want %d", err, got, exitDeadline)
+	}
+}
+
+func TestDeadlineErrorLeavesOtherErrors(t *testing.T) {
+	ctx, cancel := withRunTimeout(context.Background(), time.Hour)
+	defer cancel()
+	other := errors.New("other")
+	if err := deadlineError(ctx, time.Hour, other); err != other {
+		t.Errorf("deadlineError before the deadline = %v, want %v", err, other)
+	}
+	if err := deadlineError(ctx, time.Hour, nil); err != nil {
+		t.Errorf("deadlineError(nil) = %v, want nil", err)
+	}
+}
+
+func TestExtractPDFStopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	dir := t.TempDir()
+	// The file isn't a PDF, so extraction would fail if it were attempted.
+	inPath := filepath.Join(dir, "2024PDF", "apr.pdf")
+	if err := os.MkdirAll(filepath.Dir(inPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inPath, []byte("not a pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := extractPDF(ctx, []string{inPath}, csvDir(filepath.Join(dir, "outcsv")))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("extractPDF after the deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRecentMonth(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		now   time.Time
+		month time.Month
+		want  time.Time
+	}{
+		{date(2024, 10, 14), time.January, date(2024, 1, 1)},
+		{date(2024, 10, 14), time.March, date(2024, 3, 1)},
+		{date(2024, 10, 14), time.October, date(2024, 10, 1)},
+		{date(2024, 10, 14), time.November, date(2024, 11, 1)},
+		{date(2024, 10, 14), time.December, date(2023, 12, 1)},
+		// Around New Year the upcoming January is next year's and December is last year's.
+		{date(2024, 12, 27), time.January, date(2025, 1, 1)},
+		{date(2024, 12, 27), time.December, date(2024, 12, 1)},
+		{date(2024, 12, 27), time.February, date(2024, 2, 1)},
+		{date(2025, 1, 3), time.December, date(2024, 12, 1)},
+		{date(2025, 1, 3), time.January, date(2025, 1, 1)},
+		{date(2025, 1, 3), time.February, date(2025, 2, 1)},
+		{date(2025, 1, 3), time.March, date(2024, 3, 1)},
+	}
+	for _, tc := range tests {
+		got := recentMonth(tc.now, tc.month)
+		if want := time.Date(tc.want.Year(), tc.want.Month(), 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("recentMonth(%s, %s) = %s, want %s", tc.now.Format("2006-01-02"), tc.month,
+				got.Format("2006-01"), want.Format("2006-01"))
+		}
+	}
+}
+
+func TestMenuMonthAt(t *testing.T) {
+	tests := []struct {
+		now       time.Time
+		lookAhead int
+		want      string
+	}{
+		{time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC), 5, "2024-12"},
+		{time.Date(2024, 12, 27, 9, 0, 0, 0, time.UTC), 5, "2025-01"},
+		{time.Date(2024, 12, 27, 9, 0, 0, 0, time.UTC), 0, "2024-12"},
+		{time.Date(2025, 1, 3, 9, 0, 0, 0, time.UTC), 5, "2025-01"},
+		{time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC), 1, "2024-05"},
+	}
+	for _, tc := range tests {
+		if got := menuMonthAt(tc.now, tc.lookAhead).Format("2006-01"); got != tc.want {
+			t.Errorf("menuMonthAt(%s, %d) = %s, want %s", tc.now.Format("2006-01-02"), tc.lookAhead, got, tc.want)
+		}
+	}
+}
+
+func TestMenuCSVRootAtNewYear(t *testing.T) {
+	root := menuCSVRoot("out", time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local))
+	for inPath, want := range map[string]string{
+		"PDF/2024PDF/jan.pdf": filepath.Join("out", "2025PDF", "jan", "jan"),
+		"PDF/2025PDF/jan.pdf": filepath.Join("out", "2025PDF", "jan", "jan"),
+		"PDF/2024PDF/dec.pdf": filepath.Join("out", "2024PDF", "dec", "dec"),
+	} {
+		got, err := root(inPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("menuCSVRoot(2025-01)(%q) = %q, want %q", inPath, got, want)
+		}
+	}
+}
+
+func TestLoadMenuHTMLMaxAge(t *testing.T) {
+	cached := menuPage("2024PDF/mar.pdf")
+	served := menuPage("2024PDF/apr.pdf")
+	tests := []struct {
+		name   string
+		age    time.Duration
+		status int // status of the menu page; 0 serves it
+		want   string
+		gets   int
+	}{
+		{"fresh cache is used", time.Hour, 0, cached, 0},
+		{"stale cache is re-downloaded", 3 * time.Hour, 0, served, 1},
+		{"stale cache is kept when re-downloading fails", 3 * time.Hour, http.StatusNotFound, cached, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gets := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gets++
+				if tc.status != 0 {
+					http.Error(w, "gone", tc.status)
+					return
+				}
+				fmt.Fprint(w, served)
+			}))
+			defer srv.Close()
+
+			htmlPath := filepath.Join(t.TempDir(), "ryoushokuApril.html")
+			if err := os.WriteFile(htmlPath, []byte(cached), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(-tc.age)
+			if err := os.Chtimes(htmlPath, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadMenuHTML(context.Background(), htmlPath, srv.URL+"/ryoushoku.html", 2*time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("loadMenuHTML returned the wrong page: want the %s one", map[bool]string{true: "cached", false: "served"}[tc.want == cached])
+			}
+			if gets != tc.gets {
+				t.Errorf("menu page requested %d times, want %d", gets, tc.gets)
+			}
+			if onDisk, err := os.ReadFile(htmlPath); err != nil || string(onDisk) != tc.want {
+				t.Errorf("cached copy after loadMenuHTML doesn't match the returned page (err %v)", err)
+			}
+			if _, err := os.Stat(htmlPath + ".new"); !os.IsNotExist(err) {
+				t.Errorf("%s.new left behind", htmlPath)
+			}
+		})
+	}
+}
+
+func TestLoadMenuHTMLTruncated(t *testing.T) {
+	full := menuPage("2024PDF/apr.pdf")
+	// A menu page cut off mid-download.
+	truncated := full[:len(full)/2]
+	tests := []struct {
+		name     string
+		cached   string // cached copy; "" if there is none
+		bodies   []string
+		want     string
+		wantWarn bool
+	}{
+		{"truncated download is retried", "", []string{truncated, full}, full, false},
+		{"truncated cache is re-downloaded", truncated, []string{full}, full, false},
+		{"truncated again is parsed with a warning", "", []string{truncated, truncated}, truncated, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+			gets := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if gets < len(tc.bodies) {
+					fmt.Fprint(w, tc.bodies[gets])
+				}
+				gets++
+			}))
+			defer srv.Close()
+
+			htmlPath := filepath.Join(t.TempDir(), "ryoushokuApril.html")
+			if tc.cached != "" {
+				if err := os.WriteFile(htmlPath, []byte(tc.cached), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := loadMenuHTML(context.Background(), htmlPath, srv.URL+"/ryoushoku.html", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("loadMenuHTML returned %d bytes, want the %d-byte page", len(got), len(tc.want))
+			}
+			if warned := strings.Contains(logs.String(), "warning: "); warned != tc.wantWarn {
+				t.Errorf("log = %q, want a warning: %v", logs, tc.wantWarn)
+			}
+			if gets != len(tc.bodies) {
+				t.Errorf("menu page requested %d times, want %d", gets, len(tc.bodies))
+			}
+		})
+	}
+}
+
+func TestLooksTruncated(t *testing.T) {
+	full := menuPage("2024PDF/apr.pdf")
+	tests := []struct {
+		html string
+		want bool
+	}{
+		{full, false},
+		{strings.ToUpper(full) + "\n\n", false},
+		{full[:len(full)-len("</html>\n")], true},
+		{"<html><body></body></html>", true},
+		{"", true},
+	}
+	for _, tc := range tests {
+		if got := looksTruncated([]byte(tc.html)); got != tc.want {
+			t.Errorf("looksTruncated(%d bytes ending %q) = %v, want %v", len(tc.html), tc.html[max(0, len(tc.html)-10):], got, tc.want)
+		}
+	}
+}
+
+func TestGetDirecotry(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"apr.pdf", "."},
+		{"2024PDF/apr.pdf", "2024PDF"},
+		{"2024/04/menu.pdf", filepath.Join("2024", "04")},
+		{"a/b/c/d.pdf", filepath.Join("a", "b", "c")},
+	}
+	for _, tc := range tests {
+		got, err := getDirecotry(tc.path)
+		if err != nil || got != tc.want {
+			t.Errorf("getDirecotry(%q) = %q, %v, want %q", tc.path, got, err, tc.want)
+		}
+	}
+	if _, err := getDirecotry(""); err == nil {
+		t.Errorf("getDirecotry(\"\") succeeded")
+	}
+
+	// All the intermediate directories of a nested path get created.
+	dir := t.TempDir()
+	nested, _ := getDirecotry("2024/04/menu.pdf")
+	if err := makeDirecoty(filepath.Join(dir, nested)); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "2024", "04")); err != nil || !fi.IsDir() {
+		t.Errorf("2024/04 wasn't created: %v", err)
+	}
+}
+
+func TestDownloadFileWithRetryAfter429(t *testing.T) {
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if gets == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, fakePDF)
+	}))
+	defer srv.Close()
+
+	localPath := filepath.Join(t.TempDir(), "apr.pdf")
+	start := time.Now()
+	if err := DownloadFileWithRetry(context.Background(), localPath, srv.URL+"/apr.pdf", "", 3); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After", elapsed)
+	}
+	if gets != 2 {
+		t.Errorf("got %d requests, want 2", gets)
+	}
+	if got, err := os.ReadFile(localPath); err != nil || string(got) != fakePDF {
+		t.Errorf("downloaded %q, %v, want %q", got, err, fakePDF)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		{now.Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tc := range tests {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    time.Duration
+		ok      bool
+	}{
+		{"429 with Retry-After", &tooManyRequestsError{retryAfter: 30 * time.Second}, 1, 30 * time.Second, true},
+		{"429 without Retry-After", &tooManyRequestsError{}, 1, defaultRetryWait, true},
+		{"429 with a long Retry-After", &tooManyRequestsError{retryAfter: time.Hour}, 1, maxRetryWait, true},
+		{"5xx backs off", &httpStatusError{statusCode: 503}, 3, 4 * baseBackoff, true},
+		{"4xx isn't retried", &httpStatusError{statusCode: 404}, 1, 0, false},
+		{"other errors aren't retried", errors.New("not a PDF"), 1, 0, false},
+	}
+	for _, tc := range tests {
+		got, ok := retryWait(tc.err, tc.attempt)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s: retryWait = %s, %v, want %s, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestDownloadFileDecodesContentEncoding(t *testing.T) {
+	tests := []struct {
+		encoding string
+		writer   func(w io.Writer) io.WriteCloser
+	}{
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		// The transport only decodes "gzip" itself, so this is decoded by decodedBody.
+		{"x-gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+	}
+	for i, tc := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", tc.encoding)
+			cw := tc.writer(w)
+			io.WriteString(cw, fakePDF)
+			cw.Close()
+		}))
+		localPath := filepath.Join(t.TempDir(), "apr.pdf")
+		if err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", ""); err != nil {
+			t.Errorf("%d %s: %v", i, tc.encoding, err)
+		} else if got, err := os.ReadFile(localPath); err != nil || string(got) != fakePDF {
+			t.Errorf("%d %s: downloaded %q, %v, want %q", i, tc.encoding, got, err, fakePDF)
+		}
+		srv.Close()
+	}
+}
+
+func TestDownloadFileUnsupportedContentEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		fmt.Fprint(w, fakePDF)
+	}))
+	defer srv.Close()
+
+	localPath := filepath.Join(t.TempDir(), "apr.pdf")
+	err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported Content-Encoding") {
+		t.Errorf("got %v, want an unsupported Content-Encoding error", err)
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("%s was saved: %v", localPath, err)
+	}
+}
+
+func TestDownloadFileCreatesParentDirs(t *testing.T) {
+	srv := newMenuServer(t, menuPage("2024PDF/apr.pdf"))
+	dir := t.TempDir()
+	// A first run, in a work dir with neither html/ nor PDF/.
+	for _, localPath := range []string{
+		filepath.Join(dir, "html", "ryoushokuApril.html"),
+		filepath.Join(dir, "PDF", "2024PDF", "04", "apr.pdf"),
+	} {
+		url := srv.URL + "/kondate/" + filepath.Base(localPath)
+		if filepath.Ext(localPath) == ".html" {
+			url = srv.URL + "/kondate/ryoushoku.html"
+		}
+		if err := DownloadFile(context.Background(), localPath, url, ""); err != nil {
+			t.Fatalf("DownloadFile into %s: %v", localPath, err)
+		}
+		if fi, err := os.Stat(localPath); err != nil || fi.Size() == 0 {
+			t.Errorf("%s wasn't downloaded: %v", localPath, err)
+		}
+	}
+}
+
+// fullPDF is a menu PDF long enough to be downloaded in two parts.
+var fullPDF = fakePDF + strings.Repeat("% padding\n", 100)
+
+func TestDownloadFileResumes(t *testing.T) {
+	tests := []struct {
+		name  string
+		part  string // left by an earlier, interrupted download
+		serve func(w http.ResponseWriter, r *http.Request)
+		gets  int
+	}{
+		{"206", fullPDF[:300], func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "apr.pdf", time.Time{}, strings.NewReader(fullPDF))
+		}, 1},
+		{"Range ignored", fullPDF[:300], func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, fullPDF)
+		}, 1},
+		// The .part file is longer than the file is now, so the server answers 416.
+		{"416 restarts", fullPDF + "stale", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "apr.pdf", time.Time{}, strings.NewReader(fullPDF))
+		}, 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			captureLog(t)
+			var ranges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				tc.serve(w, r)
+			}))
+			defer srv.Close()
+			localPath := filepath.Join(t.TempDir(), "apr.pdf")
+			if err := os.WriteFile(localPath+".part", []byte(tc.part), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", ""); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := os.ReadFile(localPath); err != nil || string(got) != fullPDF {
+				t.Errorf("downloaded %d bytes, %v, want the %d byte file", len(got), err, len(fullPDF))
+			}
+			if _, err := os.Stat(localPath + ".part"); !os.IsNotExist(err) {
+				t.Errorf(".part file left behind: %v", err)
+			}
+			if len(ranges) != tc.gets {
+				t.Fatalf("got %d requests, want %d", len(ranges), tc.gets)
+			}
+			if want := fmt.Sprintf("bytes=%d-", len(tc.part)); ranges[0] != want {
+				t.Errorf("Range = %q, want %q", ranges[0], want)
+			}
+			if tc.gets > 1 && ranges[1] != "" {
+				t.Errorf("restarted download sent Range %q", ranges[1])
+			}
+		})
+	}
+}
+
+func TestDownloadFileOnlyCompleteFilesAppear(t *testing.T) {
+	captureLog(t)
+	cutOff := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cutOff {
+			http.ServeContent(w, r, "apr.pdf", time.Time{}, strings.NewReader(fullPDF))
+			return
+		}
+		// The connection drops half way through the file.
+		w.Header().Set("Content-Length", fmt.Sprint(len(fullPDF)))
+		io.WriteString(w, fullPDF[:len(fullPDF)/2])
+	}))
+	defer srv.Close()
+	localPath := filepath.Join(t.TempDir(), "apr.pdf")
+	partPath := localPath + ".part"
+
+	if err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", ""); err == nil {
+		t.Fatal("cut off download succeeded")
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("cut off download saved as %s: %v", localPath, err)
+	}
+	if got, err := os.ReadFile(partPath); err != nil || string(got) != fullPDF[:len(fullPDF)/2] {
+		t.Errorf("cut off download left %d bytes in .part, %v, want the %d received", len(got), err, len(fullPDF)/2)
+	}
+
+	cutOff = false
+	if err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(localPath); err != nil || string(got) != fullPDF {
+		t.Errorf("resumed download = %d bytes, %v, want %d", len(got), err, len(fullPDF))
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Errorf(".part left after the download completed: %v", err)
+	}
+}
+
+func TestDownloadFileRemovesUnresumablePart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 300-%d/%d", len(fullPDF)-1, len(fullPDF)))
+		w.WriteHeader(http.StatusPartialContent)
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, fullPDF[300:])
+		gz.Close()
+	}))
+	defer srv.Close()
+	localPath := filepath.Join(t.TempDir(), "apr.pdf")
+	if err := os.WriteFile(localPath+".part", []byte(fullPDF[:300]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	if err := DownloadFile(context.Background(), localPath, srv.URL+"/apr.pdf", ""); err == nil {
+		t.Fatal("resuming an encoded range succeeded")
+	}
+	for _, path := range []string{localPath, localPath + ".part"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left after the failed download: %v", path, err)
+		}
+	}
+}
+
+func TestDownloadFileRejectsNonPDF(t *testing.T) {
+	tests := []struct {
+		name, localName, body string
+		ok                    bool
+	}{
+		{"HTML error page", "apr.pdf", "<html><body>メンテナンス中</body></html>", false},
+		{"empty", "apr.pdf", "", false},
+		{"PDF", "apr.pdf", fakePDF, true},
+		{"junk before the header", "apr.pdf", "\r\n\r\n" + fakePDF, true},
+		// Only downloads into .pdf files are checked.
+		{"menu page", "ryoushoku.html", menuPage(), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+			localPath := filepath.Join(t.TempDir(), tc.localName)
+			err := DownloadFile(context.Background(), localPath, srv.URL+"/"+tc.localName, "")
+			if tc.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), `not a PDF (Content-Type "text/html; charset=utf-8"`) {
+				t.Errorf("DownloadFile = %v, want a not a PDF error naming the Content-Type", err)
+			}
+			for _, path := range []string{localPath, localPath + ".part"} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s saved: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadFileNon2xx(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusInternalServerError, http.StatusMultipleChoices} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+			fmt.Fprint(w, "<html><body>Not Found</body></html>")
+		}))
+		url := srv.URL + "/2024PDF/apr.pdf"
+		localPath := filepath.Join(t.TempDir(), "apr.pdf")
+		err := DownloadFile(context.Background(), localPath, url, "")
+		var status *httpStatusError
+		if !errors.As(err, &status) || status.statusCode != code {
+			t.Errorf("%d: DownloadFile = %v, want an httpStatusError", code, err)
+		} else if msg := err.Error(); !strings.Contains(msg, url) || !strings.Contains(msg, http.StatusText(code)) {
+			t.Errorf("%d: error %q doesn't name the URL and status", code, msg)
+		}
+		for _, path := range []string{localPath, localPath + ".part"} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("%d: %s saved: %v", code, path, err)
+			}
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// mealsCommand implements the `meals` subcommand. It parses the meals in the grid CSV files
+// matched by the patterns in `args` (or every CSV under -csvdir when none are given) with
+// parseMealsFromCSV and writes them to stdout as JSON, as WriteMealsJSON does. The files are read
+// in sorted order, and the meals of each override the ones of the same date and type before it,
+// as by reconcileMeals, so a correction of part of a month sorted after the original wins.
+func mealsCommand(args []string) error {
+	fs := flag.NewFlagSet("meals", flag.ExitOnError)
+	dir := fs.String("csvdir", "./outcsv", "directory searched for CSV files when no patterns are given")
+	pretty := fs.Bool("json-pretty", false, "indent the JSON for reading (default compact)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s meals [-csvdir dir] [-json-pretty] [pattern ...]\n", filepath.Base(flag.CommandLine.Name()))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{filepath.Join(*dir, "**", "*.csv")}
+	}
+	pathList, err := patternsToPaths(patterns)
+	if err != nil {
+		return err
+	}
+	meals, err := parseMealsFromCSVs(pathList)
+	if err != nil {
+		return err
+	}
+	return WriteMealsJSON(os.Stdout, meals, *pretty)
+}
+
+// parseMealsFromCSVs returns the meals in grid CSV files `pathList`, as parsed by
+// parseMealsFromCSV, with the meals of each file overriding the ones of the same date and type
+// before it, as by reconcileMeals. Files without a month in their path are skipped with a
+// warning, since their dates can't be known.
+func parseMealsFromCSVs(pathList []string) ([]Meal, error) {
+	var meals []Meal
+	for _, path := range pathList {
+		pathMeals, err := parseMealsFromCSV(path)
+		if errors.Is(err, errNoMenuMonth) {
+			log.Printf("warning: skipping %s: no month in its path", path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		meals = reconcileMeals(meals, pathMeals)
+	}
+	return meals, nil
+}
+
+// parseMealsFromCSV returns the meals in grid CSV file `path`, as written by saveCSVFiles, with
+// the default MealOptions. This lets a CSV corrected by hand be parsed again without its PDF. The
+// month comes from the file name and the year from the directories above it, e.g. April 2024 for
+// outcsv/2024PDF/apr/apr.page1.table1.csv; without a year it is chosen as by ParseMeals.
+//
+// The cells' line breaks aren't kept in the CSV files, so each cell is one dish unless line
+// breaks are put back into it.
+func parseMealsFromCSV(path string) ([]Meal, error) {
+	table, err := readCSVTable(path)
+	if err != nil {
+		return nil, err
+	}
+	year, month := pathMonth(path)
+	if dirYear, dirMonth := pathMonth(filepath.Dir(path)); year == 0 {
+		year = dirYear
+		if month == 0 {
+			month = dirMonth
+		}
+	}
+	r := docTables{
+		pageTables: map[int][]stringTable{1: {table}},
+		year:       year,
+		month:      month,
+	}
+	meals, _, err := ParseMeals(r, MealOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return meals, nil
+}
+
+// readCSVTable returns the table in CSV file `path`. Unlike the CSV files written by WriteCSV,
+// its rows may have different numbers of cells.
+func readCSVTable(path string) (stringTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Keep line breaks put into the cells by hand, which split dishes.
+	for _, row := range rows {
+		for x, cell := range row {
+			row[x] = normalizeLines(cell)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMealsFromCSVRoundTrip(t *testing.T) {
+	table := stringTable{
+		{"日付", "朝食", "夕食", "エネルギー"},
+		{"1日(月)", "ご飯 味噌汁", "カレー", "820"},
+		{"2日(火)", "休", "ご飯\n焼き魚", ""},
+	}
+	path := filepath.Join(t.TempDir(), "2024PDF", "apr", "apr.page1.table1.csv")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCSV(f, table); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meals, err := parseMealsFromCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mealSummary{
+		{"2024-04-01", Breakfast, []string{"ご飯 味噌汁"}},
+		{"2024-04-01", Dinner, []string{"カレー"}},
+		{"2024-04-02", Breakfast, nil},
+		{"2024-04-02", Dinner, []string{"ご飯", "焼き魚"}},
+	}
+	if got := summarizeMeals(meals); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if !meals[1].CaloriesOK || meals[1].Calories != 820 {
+		t.Errorf("dinner calories = %g, %v, want 820", meals[1].Calories, meals[1].CaloriesOK)
+	}
+	if !meals[2].Closed {
+		t.Errorf("breakfast on the 2nd isn't closed")
+	}
+}
+
+func TestParseMealsFromCSVNoMonth(t *testing.T) {
+	// t.TempDir() ends in a number, which would be taken as the month.
+	path := filepath.Join(t.TempDir(), "edited", "menu.csv")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("日付,夕食\n1,カレー\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseMealsFromCSV(path); !errors.Is(err, errNoMenuMonth) {
+		t.Errorf("parseMealsFromCSV(%q) with no month in the path: err = %v, want errNoMenuMonth", path, err)
+	}
+}
+
+func TestParseMealsFromCSVsSkipsNoMonth(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"2024PDF/apr/apr.page1.table1.csv": "日付,夕食\n1,カレー\n",
+		"edited/menu.csv":                  "日付,夕食\n2,うどん\n",
+	})
+	meals, err := parseMealsFromCSVs([]string{
+		filepath.Join(dir, "edited", "menu.csv"),
+		filepath.Join(dir, "2024PDF", "apr", "apr.page1.table1.csv"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mealSummary{{"2024-04-01", Dinner, []string{"カレー"}}}
+	if got := summarizeMeals(meals); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if line := "warning: skipping " + filepath.Join(dir, "edited", "menu.csv"); !strings.Contains(logs.String(), line) {
+		t.Errorf("log = %q, want it to contain %q", logs, line)
+	}
+}
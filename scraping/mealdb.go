@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver; pure Go, no cgo
+)
+
+// sqliteDriver is the database/sql driver name that OpenMealDB uses.
+const sqliteDriver = "sqlite"
+
+// mealDBMigrations are the schema changes of the meal database, in order. The database's
+// user_version is the number of them that have been applied. Append new ones; never edit old ones.
+var mealDBMigrations = []string{
+	`CREATE TABLE meals (
+		id       INTEGER PRIMARY KEY,
+		date     TEXT NOT NULL, -- YYYY-MM-DD
+		type     TEXT NOT NULL, -- MealType.String()
+		closed   INTEGER NOT NULL DEFAULT 0,
+		calories INTEGER,       -- NULL unless Meal.CaloriesOK
+		UNIQUE (date, type)
+	);
+	CREATE TABLE meal_items (
+		meal_id  INTEGER NOT NULL REFERENCES meals (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name     TEXT NOT NULL,
+		PRIMARY KEY (meal_id, position)
+	);
+	CREATE TABLE meal_nutrition (
+		meal_id INTEGER PRIMARY KEY REFERENCES meals (id) ON DELETE CASCADE,
+		protein REAL NOT NULL,
+		fat     REAL NOT NULL,
+		carbs   REAL NOT NULL,
+		salt    REAL NOT NULL
+	);`,
+	// A comment here would be stored in the schema's CREATE TABLE, breaking it.
+	`ALTER TABLE meals ADD COLUMN event TEXT NOT NULL DEFAULT ''`, // Meal.Event
+	`ALTER TABLE meal_items ADD COLUMN grams REAL`,                // Item.Grams; NULL if not given
+}
+
+// MealDB is a SQLite database of parsed meals.
+type MealDB struct {
+	db *sql.DB
+}
+
+// OpenMealDB opens the SQLite meal database at `path`, creating it if needed, and brings its
+// schema up to date. The migration is abandoned if `ctx` is done.
+func OpenMealDB(ctx context.Context, path string) (*MealDB, error) {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	m := &MealDB{db: db}
+	if err := m.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// openMealDBReadOnly opens the existing SQLite meal database at `path` for reading only. Its
+// schema must be up to date, since it can't be migrated.
+func openMealDBReadOnly(ctx context.Context, path string) (*MealDB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(sqliteDriver, "file:"+filepath.ToSlash(path)+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if version != len(mealDBMigrations) {
+		db.Close()
+		return nil, fmt.Errorf("%s: schema version %d isn't this program's %d; run with -meals-db to migrate it",
+			path, version, len(mealDBMigrations))
+	}
+	return &MealDB{db: db}, nil
+}
+
+// Close closes the database.
+func (m *MealDB) Close() error {
+	return m.db.Close()
+}
+
+// migrate applies the mealDBMigrations that haven't been applied yet, in one transaction.
+func (m *MealDB) migrate(ctx context.Context) error {
+	var version int
+	if err := m.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(mealDBMigrations) {
+		return fmt.Errorf("schema version %d is newer than this program's %d", version, len(mealDBMigrations))
+	}
+	if version == len(mealDBMigrations) {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, migration := range mealDBMigrations[version:] {
+		if _, err := tx.ExecContext(ctx, migration); err != nil {
+			return fmt.Errorf("migration %d: %w", version+i+1, err)
+		}
+	}
+	// PRAGMA doesn't take parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(mealDBMigrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpsertMeals stores `meals` in one transaction. A meal with the same date and type as a stored
+// one replaces it, items and nutrition included, so re-running on a menu updates it without
+// duplicating it. The transaction is rolled back if `ctx` is done first.
+func (m *MealDB) UpsertMeals(ctx context.Context, meals []Meal) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, meal := range meals {
+		if err := upsertMeal(ctx, tx, meal); err != nil {
+			return fmt.Errorf("%s %s: %w", meal.Date.Format("2006-01-02"), meal.Type, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// upsertMeal stores `meal` in `tx`, replacing any stored meal with the same date and type.
+func upsertMeal(ctx context.Context, tx *sql.Tx, meal Meal) error {
+	date := meal.Date.Format("2006-01-02")
+	// SQLite keeps a figure with decimals as a REAL in the INTEGER column.
+	var calories sql.NullFloat64
+	if meal.CaloriesOK {
+		calories = sql.NullFloat64{Float64: meal.Calories, Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO meals (date, type, closed, calories, event) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (date, type) DO UPDATE SET
+			closed = excluded.closed, calories = excluded.calories, event = excluded.event`,
+		date, meal.Type.String(), meal.Closed, calories, meal.Event); err != nil {
+		return err
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM meals WHERE date = ? AND type = ?`,
+		date, meal.Type.String()).Scan(&id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM meal_items WHERE meal_id = ?`, id); err != nil {
+		return err
+	}
+	for i, item := range meal.items() {
+		var grams sql.NullFloat64
+		if item.Grams != 0 {
+			grams = sql.NullFloat64{Float64: item.Grams, Valid: true}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO meal_items (meal_id, position, name, grams) VALUES (?, ?, ?, ?)`,
+			id, i, item.Name, grams); err != nil {
+			return err
+		}
+	}
+
+	if meal.Nutrition == (Nutrition{}) {
+		_, err := tx.ExecContext(ctx, `DELETE FROM meal_nutrition WHERE meal_id = ?`, id)
+		return err
+	}
+	n := meal.Nutrition
+	_, err := tx.ExecContext(ctx, `INSERT INTO meal_nutrition (meal_id, protein, fat, carbs, salt) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (meal_id) DO UPDATE SET
+			protein = excluded.protein, fat = excluded.fat, carbs = excluded.carbs, salt = excluded.salt`,
+		id, n.Protein, n.Fat, n.Carbs, n.Salt)
+	return err
+}
+
+// MealsInMonths returns the stored meals of the months `months`, each YYYY-MM, ordered by date
+// and meal type. Their Source isn't stored, so it is "".
+func (m *MealDB) MealsInMonths(ctx context.Context, months []string) ([]Meal, error) {
+	var meals []Meal
+	for _, month := range months {
+		monthMeals, err := m.mealsInMonth(ctx, month)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", month, err)
+		}
+		meals = append(meals, monthMeals...)
+	}
+	return meals, nil
+}
+
+// mealsInMonth returns the stored meals of `month`, as for MealsInMonths.
+func (m *MealDB) mealsInMonth(ctx context.Context, month string) ([]Meal, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT meals.id, date, type, closed, calories, event,
+			protein, fat, carbs, salt
+		FROM meals LEFT JOIN meal_nutrition ON meal_nutrition.meal_id = meals.id
+		WHERE substr(date, 1, 7) = ?
+		ORDER BY date, CASE type WHEN 'breakfast' THEN 1 WHEN 'lunch' THEN 2 ELSE 3 END`, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var meals []Meal
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var date, mealType string
+		var meal Meal
+		var calories, protein, fat, carbs, salt sql.NullFloat64
+		if err := rows.Scan(&id, &date, &mealType, &meal.Closed, &calories, &meal.Event,
+			&protein, &fat, &carbs, &salt); err != nil {
+			return nil, err
+		}
+		if meal.Date, err = time.ParseInLocation("2006-01-02", date, time.Local); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if meal.Type, ok = mealTypeNamed(mealType); !ok {
+			return nil, fmt.Errorf("%s: bad meal type %q", date, mealType)
+		}
+		meal.Calories, meal.CaloriesOK = calories.Float64, calories.Valid
+		meal.Nutrition = Nutrition{Protein: protein.Float64, Fat: fat.Float64, Carbs: carbs.Float64, Salt: salt.Float64}
+		meals = append(meals, meal)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if err := m.readItems(ctx, id, &meals[i]); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", meals[i].Date.Format("2006-01-02"), meals[i].Type, err)
+		}
+	}
+	return meals, nil
+}
+
+// readItems sets the Items and Dishes of `meal`, stored with id `id`, from the database.
+func (m *MealDB) readItems(ctx context.Context, id int64, meal *Meal) error {
+	rows, err := m.db.QueryContext(ctx, `SELECT name, grams FROM meal_items WHERE meal_id = ? ORDER BY position`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item Item
+		var grams sql.NullFloat64
+		if err := rows.Scan(&item.Name, &grams); err != nil {
+			return err
+		}
+		item.Grams = grams.Float64
+		meal.Items = append(meal.Items, item.Name)
+		meal.Dishes = append(meal.Dishes, item)
+	}
+	return rows.Err()
+}
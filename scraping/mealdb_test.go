@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpsertMealsUpdatesInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meals.db")
+	db, err := OpenMealDB(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)
+	first := []Meal{
+		{Date: day, Type: Breakfast, Items: []string{"ご飯", "味噌汁"}, Calories: 600, CaloriesOK: true,
+			Nutrition: Nutrition{Protein: 20, Salt: 2.5}},
+		{Date: day, Type: Dinner, Items: []string{"カレー"}, Event: "誕生日メニュー"},
+	}
+	if err := db.UpsertMeals(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	second := []Meal{
+		{Date: day, Type: Breakfast, Items: []string{"パン"}, Dishes: []Item{{"パン", 60}}, Calories: 500, CaloriesOK: true,
+			Nutrition: Nutrition{Protein: 15, Fat: 10}},
+		{Date: day, Type: Dinner, Closed: true},
+	}
+	if err := db.UpsertMeals(context.Background(), second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening runs the migrations again, which must be a no-op.
+	db.Close()
+	if db, err = OpenMealDB(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	var meals int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM meals`).Scan(&meals); err != nil {
+		t.Fatal(err)
+	}
+	if meals != 2 {
+		t.Errorf("got %d meal rows, want 2", meals)
+	}
+
+	var id, calories int
+	if err := db.db.QueryRow(`SELECT id, calories FROM meals WHERE date = '2024-04-01' AND type = 'breakfast'`).
+		Scan(&id, &calories); err != nil {
+		t.Fatal(err)
+	}
+	if calories != 500 {
+		t.Errorf("breakfast calories = %d, want 500", calories)
+	}
+
+	rows, err := db.db.Query(`SELECT name, grams FROM meal_items WHERE meal_id = ? ORDER BY position`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []Item
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.Name, &item.Grams); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if want := []Item{{"パン", 60}}; !reflect.DeepEqual(items, want) {
+		t.Errorf("breakfast items = %v, want %v", items, want)
+	}
+
+	var n Nutrition
+	if err := db.db.QueryRow(`SELECT protein, fat, carbs, salt FROM meal_nutrition WHERE meal_id = ?`, id).
+		Scan(&n.Protein, &n.Fat, &n.Carbs, &n.Salt); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Nutrition{Protein: 15, Fat: 10}); n != want {
+		t.Errorf("breakfast nutrition = %+v, want %+v", n, want)
+	}
+
+	var closed bool
+	var dinnerItems int
+	var event string
+	if err := db.db.QueryRow(`SELECT closed, event, (SELECT COUNT(*) FROM meal_items WHERE meal_id = meals.id)
+		FROM meals WHERE type = 'dinner'`).Scan(&closed, &event, &dinnerItems); err != nil {
+		t.Fatal(err)
+	}
+	if !closed || dinnerItems != 0 || event != "" {
+		t.Errorf("dinner closed = %v with %d items and event %q, want closed with none", closed, dinnerItems, event)
+	}
+}
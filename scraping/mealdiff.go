@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MealDiff is a difference between the stored and freshly parsed meal of one date and type.
+type MealDiff struct {
+	Date   time.Time
+	Type   MealType
+	Stored *Meal // nil if only parsed
+	Parsed *Meal // nil if only stored
+}
+
+// String describes `d`, e.g. "changed 2024-04-15 lunch: items [カレー] -> [ハヤシライス]".
+func (d MealDiff) String() string {
+	key := d.Date.Format("2006-01-02") + " " + d.Type.String()
+	switch {
+	case d.Stored == nil:
+		return fmt.Sprintf("added %s: %s", key, mealDescription(*d.Parsed))
+	case d.Parsed == nil:
+		return fmt.Sprintf("removed %s: %s", key, mealDescription(*d.Stored))
+	}
+	return fmt.Sprintf("changed %s: %s", key, strings.Join(mealChanges(*d.Stored, *d.Parsed), "; "))
+}
+
+// DiffMeals returns the differences between `stored` and `parsed` meals, matched by date and
+// type: the parsed meals that differ from the stored ones or aren't stored, in the order of
+// `parsed`, then the stored meals that weren't parsed, in the order of `stored`.
+func DiffMeals(stored, parsed []Meal) []MealDiff {
+	byKey := make(map[mealKey]int, len(stored))
+	for i, meal := range stored {
+		byKey[meal.key()] = i
+	}
+	var diffs []MealDiff
+	matched := make(map[int]bool)
+	for i := range parsed {
+		p := &parsed[i]
+		j, ok := byKey[p.key()]
+		if !ok {
+			diffs = append(diffs, MealDiff{Date: p.Date, Type: p.Type, Parsed: p})
+			continue
+		}
+		matched[j] = true
+		if len(mealChanges(stored[j], *p)) > 0 {
+			diffs = append(diffs, MealDiff{Date: p.Date, Type: p.Type, Stored: &stored[j], Parsed: p})
+		}
+	}
+	for j := range stored {
+		if !matched[j] {
+			diffs = append(diffs, MealDiff{Date: stored[j].Date, Type: stored[j].Type, Stored: &stored[j]})
+		}
+	}
+	return diffs
+}
+
+// mealChanges returns a description of each stored field of meal `a` that `b` has differently.
+func mealChanges(a, b Meal) []string {
+	var changes []string
+	if x, y := dishesText(a), dishesText(b); x != y {
+		changes = append(changes, fmt.Sprintf("items %s -> %s", x, y))
+	}
+	if a.Closed != b.Closed {
+		changes = append(changes, fmt.Sprintf("closed %v -> %v", a.Closed, b.Closed))
+	}
+	if x, y := caloriesText(a), caloriesText(b); x != y {
+		changes = append(changes, fmt.Sprintf("calories %s -> %s", x, y))
+	}
+	if a.Event != b.Event {
+		changes = append(changes, fmt.Sprintf("event %q -> %q", a.Event, b.Event))
+	}
+	if a.Nutrition != b.Nutrition {
+		changes = append(changes, fmt.Sprintf("nutrition %+v -> %+v", a.Nutrition, b.Nutrition))
+	}
+	return changes
+}
+
+// mealDescription returns the dishes and calories of `meal`, or "closed".
+func mealDescription(meal Meal) string {
+	if meal.Closed {
+		return "closed"
+	}
+	return dishesText(meal) + " " + caloriesText(meal)
+}
+
+// dishesText returns the dishes of `meal` with any weights, e.g. "[ごはん 200g 味噌汁]".
+func dishesText(meal Meal) string {
+	var names []string
+	for _, item := range meal.items() {
+		if item.Grams != 0 {
+			names = append(names, fmt.Sprintf("%s %gg", item.Name, item.Grams))
+		} else {
+			names = append(names, item.Name)
+		}
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// caloriesText returns the calories of `meal`, e.g. "650kcal", or "-" if the menu gives none.
+func caloriesText(meal Meal) string {
+	if !meal.CaloriesOK {
+		return "-"
+	}
+	return fmt.Sprintf("%gkcal", meal.Calories)
+}
+
+// compareStoreCommand implements the `compare-store` subcommand. It parses the meals in the grid
+// CSV files matched by the patterns in `args` (or every CSV under -csvdir when none are given) as
+// the `meals` subcommand does, and prints the DiffMeals of the meals stored in the -db database
+// for those months against them, writing nothing. It returns an error wrapping errMealDrift if
+// there are differences, for alerts from CI.
+func compareStoreCommand(args []string) error {
+	fs := flag.NewFlagSet("compare-store", flag.ExitOnError)
+	dir := fs.String("csvdir", "./outcsv", "directory searched for CSV files when no patterns are given")
+	dbPath := fs.String("db", "", "SQLite meal database written by -meals-db to compare against (required)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare-store -db file [-csvdir dir] [pattern ...]\n", filepath.Base(flag.CommandLine.Name()))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *dbPath == "" {
+		return fmt.Errorf("compare-store: -db is required")
+	}
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{filepath.Join(*dir, "**", "*.csv")}
+	}
+	pathList, err := patternsToPaths(patterns)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseMealsFromCSVs(pathList)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	diffs, err := compareStore(ctx, *dbPath, parsed)
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %d meals differ from %s", errMealDrift, len(diffs), *dbPath)
+	}
+	return nil
+}
+
+// compareStore returns the DiffMeals of the meals stored in the meal database at `dbPath` for the
+// months of `parsed` against `parsed`. The database is opened read-only.
+func compareStore(ctx context.Context, dbPath string, parsed []Meal) ([]MealDiff, error) {
+	db, err := openMealDBReadOnly(ctx, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var months []string
+	seen := make(map[string]bool)
+	for _, meal := range parsed {
+		if month := meal.Date.Format("2006-01"); !seen[month] {
+			seen[month] = true
+			months = append(months, month)
+		}
+	}
+	stored, err := db.MealsInMonths(ctx, months)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dbPath, err)
+	}
+	return DiffMeals(stored, parsed), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffMeals(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	stored := []Meal{
+		{Date: day(1), Type: Breakfast, Items: []string{"ご飯", "味噌汁"}, Calories: 600, CaloriesOK: true},
+		{Date: day(1), Type: Lunch, Items: []string{"カレー"}, Dishes: []Item{{"カレー", 300}}},
+		{Date: day(1), Type: Dinner, Items: []string{"焼き魚"}},
+	}
+	parsed := []Meal{
+		{Date: day(2), Type: Breakfast, Closed: true},
+		{Date: day(1), Type: Lunch, Items: []string{"カレー"}, Dishes: []Item{{"カレー", 250}}, Calories: 800, CaloriesOK: true},
+		{Date: day(1), Type: Breakfast, Items: []string{"ご飯", "味噌汁"}, Calories: 600, CaloriesOK: true},
+	}
+	var got []string
+	for _, diff := range DiffMeals(stored, parsed) {
+		got = append(got, diff.String())
+	}
+	want := []string{
+		"added 2024-04-02 breakfast: closed",
+		"changed 2024-04-01 lunch: items [カレー 300g] -> [カレー 250g]; calories - -> 800kcal",
+		"removed 2024-04-01 dinner: [焼き魚] -",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffMeals =\n%q\nwant\n%q", got, want)
+	}
+	if diffs := DiffMeals(stored, stored); len(diffs) != 0 {
+		t.Errorf("DiffMeals of the same meals = %v, want none", diffs)
+	}
+}
+
+func TestCompareStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "meals.db")
+	if _, err := compareStore(ctx, path, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("compareStore with no database: err = %v, want a not-exist error", err)
+	}
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 0, 0, 0, 0, time.Local) }
+	stored := []Meal{
+		{Date: day(time.April, 1), Type: Dinner, Items: []string{"カレー"}, Calories: 800, CaloriesOK: true,
+			Nutrition: Nutrition{Protein: 20, Salt: 2.5}, Event: "誕生日メニュー"},
+		{Date: day(time.April, 1), Type: Breakfast, Items: []string{"パン"}, Dishes: []Item{{"パン", 60}}},
+		{Date: day(time.April, 2), Type: Lunch, Closed: true},
+		// Not compared, since nothing parsed is from May.
+		{Date: day(time.May, 1), Type: Lunch, Items: []string{"うどん"}},
+	}
+	db, err := OpenMealDB(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpsertMeals(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := compareStore(ctx, path, stored[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("compareStore of the stored meals = %v, want no differences", diffs)
+	}
+
+	parsed := []Meal{
+		{Date: day(time.April, 1), Type: Breakfast, Items: []string{"パン"}, Dishes: []Item{{"パン", 60}}},
+		{Date: day(time.April, 1), Type: Dinner, Items: []string{"ハヤシライス"}, Calories: 800, CaloriesOK: true,
+			Nutrition: Nutrition{Protein: 20, Salt: 2.5}, Event: "誕生日メニュー"},
+	}
+	diffs, err = compareStore(ctx, path, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, diff := range diffs {
+		got = append(got, diff.String())
+	}
+	want := []string{
+		"changed 2024-04-01 dinner: items [カレー] -> [ハヤシライス]",
+		"removed 2024-04-02 lunch: closed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareStore =\n%q\nwant\n%q", got, want)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Error("compareStore modified the database")
+	}
+}
@@ -0,0 +1,781 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MealType is the meal of the day that a Meal is served at.
+type MealType int
+
+const (
+	Breakfast MealType = iota + 1
+	Lunch
+	Dinner
+)
+
+// String returns the name of `m`, e.g. "breakfast".
+func (m MealType) String() string {
+	switch m {
+	case Breakfast:
+		return "breakfast"
+	case Lunch:
+		return "lunch"
+	case Dinner:
+		return "dinner"
+	}
+	return fmt.Sprintf("MealType(%d)", int(m))
+}
+
+// Meal is one meal on one day's menu.
+type Meal struct {
+	Date     time.Time
+	Type     MealType
+	Items    []string // names of the dishes, in menu order; the plain view of Dishes
+	Dishes   []Item   // the dishes with any weights, e.g. 200g for "ごはん 200g"; may be nil if Items is set
+	Closed   bool     // the cafeteria is closed for this meal; Items is empty
+	Calories float64  // kcal, as given by the menu or rounded; 0 unless CaloriesOK
+	// CaloriesOK is true if Calories was read from the menu. It is false if the menu gives no
+	// figure, or a range rather than one figure.
+	CaloriesOK bool
+	Nutrition  Nutrition
+	Event      string // the special menu the meal is, e.g. "誕生日メニュー"; "" for an ordinary meal
+	Source     string // URL of the PDF the meal was read from; "" if unknown
+	// Footnotes is the menu's legend text of each footnote mark in Items, e.g. "※1" for
+	// "カレー※1"; nil if Items has no marks with a legend.
+	Footnotes map[string]string
+}
+
+// Item is one dish of a Meal.
+type Item struct {
+	Name  string  `json:"name"`
+	Grams float64 `json:"grams,omitempty"` // 0 if the menu doesn't give a weight
+}
+
+// mealKey identifies the meal of one date, as YYYY-MM-DD, and type.
+type mealKey struct {
+	date     string
+	mealType MealType
+}
+
+// key returns the mealKey of `m`.
+func (m Meal) key() mealKey {
+	return mealKey{m.Date.Format("2006-01-02"), m.Type}
+}
+
+// items returns the Dishes of `m`, or its Items without weights if its Dishes aren't set.
+func (m Meal) items() []Item {
+	if m.Dishes != nil {
+		return m.Dishes
+	}
+	items := make([]Item, len(m.Items))
+	for i, name := range m.Items {
+		items[i] = Item{Name: name}
+	}
+	return items
+}
+
+// mealJSON is the JSON encoding of a Meal.
+type mealJSON struct {
+	Date      string            `json:"date"`
+	Type      string            `json:"type"`
+	Items     []string          `json:"items,omitempty"`
+	Closed    bool              `json:"closed,omitempty"`
+	Calories  *float64          `json:"calories,omitempty"`  // omitted unless CaloriesOK
+	Nutrition *Nutrition        `json:"nutrition,omitempty"` // omitted if all zero
+	Event     string            `json:"event,omitempty"`
+	Dishes    []Item            `json:"dishes,omitempty"` // omitted unless a dish has a weight
+	Source    string            `json:"source,omitempty"`
+	Footnotes map[string]string `json:"footnotes,omitempty"`
+}
+
+// MarshalJSON encodes `m` with its date as YYYY-MM-DD and its type by name.
+func (m Meal) MarshalJSON() ([]byte, error) {
+	j := mealJSON{
+		Date:      m.Date.Format("2006-01-02"),
+		Type:      m.Type.String(),
+		Items:     m.Items,
+		Closed:    m.Closed,
+		Event:     m.Event,
+		Source:    m.Source,
+		Footnotes: m.Footnotes,
+	}
+	if m.CaloriesOK {
+		j.Calories = &m.Calories
+	}
+	if m.Nutrition != (Nutrition{}) {
+		j.Nutrition = &m.Nutrition
+	}
+	for _, item := range m.Dishes {
+		if item.Grams != 0 {
+			j.Dishes = m.Dishes
+			break
+		}
+	}
+	// json.Marshal would escape & < > in dish names, which WriteMealsJSON's encoder can't undo.
+	b := new(bytes.Buffer)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(j); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// WriteMealsJSON writes `meals` to `w` as a JSON object from each month, as YYYY-MM, to the meals
+// in it. The JSON is compact unless `pretty`, which indents it by two spaces.
+func WriteMealsJSON(w io.Writer, meals []Meal, pretty bool) error {
+	byMonth := make(map[string][]Meal)
+	for _, meal := range meals {
+		month := meal.Date.Format("2006-01")
+		byMonth[month] = append(byMonth[month], meal)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(byMonth)
+}
+
+// saveMeals writes `meals` to <csvRoot>.meals.json, indented if `pretty`.
+func saveMeals(csvRoot string, meals []Meal, pretty bool) error {
+	mealsPath := csvRoot + ".meals.json"
+	b := new(bytes.Buffer)
+	if err := WriteMealsJSON(b, meals, pretty); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(mealsPath, b.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write mealsPath=%q err=%w", mealsPath, err)
+	}
+	return nil
+}
+
+// errNoMenuMonth is returned by ParseMeals for a document it can't date.
+var errNoMenuMonth = errors.New("no menu month found on the first page or in the path")
+
+// MealOptions controls how ParseMeals reads meals from the menu tables. The zero value is the
+// defaults.
+type MealOptions struct {
+	// ClosedTokens are the meal cell texts that mean the cafeteria is closed rather than a dish.
+	// nil means defaultClosedTokens.
+	ClosedTokens []string
+	// RoundCalories rounds Meal.Calories to the nearest 10 kcal, for totals that stay consistent
+	// across months whose menus give figures to different precisions. false keeps the menus'
+	// figures as given.
+	RoundCalories bool
+}
+
+// defaultClosedTokens is the default MealOptions.ClosedTokens.
+var defaultClosedTokens = []string{"休", "休み", "休業", "休館", "閉館", "なし"}
+
+// notServedTokens are the meal cell texts that mean a meal isn't served that day, e.g. a dash
+// under 朝食 on weekends. Such cells have no meal, like blank ones, rather than a closed one.
+var notServedTokens = []string{"-", "―", "—"}
+
+// calories returns `kcal` rounded as set by `opts`.
+func (opts MealOptions) calories(kcal float64) float64 {
+	if opts.RoundCalories {
+		return math.Round(kcal/10) * 10
+	}
+	return kcal
+}
+
+// closedTokens returns the closed-day tokens of `opts`.
+func (opts MealOptions) closedTokens() []string {
+	if opts.ClosedTokens == nil {
+		return defaultClosedTokens
+	}
+	return opts.ClosedTokens
+}
+
+// mealTypeHeaders are the column headers of the meal types in the menu tables, which are
+// sometimes shortened to one character.
+var mealTypeHeaders = []struct {
+	header   string
+	short    string
+	mealType MealType
+}{
+	{"朝食", "朝", Breakfast},
+	{"昼食", "昼", Lunch},
+	{"夕食", "夕", Dinner},
+}
+
+// ParseMeals returns the meals in the tables of `r`, in table order. The dates are days of the
+// month in `r`, from its first page or its path; if `r` has no year, the year is the most recent
+// one with that month, as for recentMonth. Tables that don't look like a menu are skipped. Each
+// meal's Source is the URL that `r` was downloaded from, and its Footnotes are the entries of the
+// legend of `r` for the marks in its items. The warnings are where the tables couldn't be read
+// for sure, in table order; they are also logged.
+func ParseMeals(r docTables, opts MealOptions) ([]Meal, []parseWarning, error) {
+	if r.month == 0 {
+		return nil, nil, errNoMenuMonth
+	}
+	year := r.year
+	if year == 0 {
+		year = recentMonth(time.Now(), r.month).Year()
+	}
+	var meals []Meal
+	warnings := &mealWarnings{}
+	for _, table := range r.mealTables() {
+		warnings.page, warnings.table = table.page, table.table
+		meals = append(meals, parseMealTable(table.cells, year, r.month, opts, warnings)...)
+	}
+	for i := range meals {
+		meals[i].Source = r.sourceURL
+		meals[i].Footnotes = footnotesOf(meals[i].Items, r.footnotes)
+	}
+	return meals, warnings.list, nil
+}
+
+// reconcileMeals returns `base` with the meals of `override` in place of the ones of the same date
+// and type, as for a corrected menu that covers only part of the month, followed by the meals of
+// `override` that aren't in `base`. The days with overridden meals are logged.
+func reconcileMeals(base, override []Meal) []Meal {
+	key := Meal.key
+	overrides := make(map[mealKey]Meal, len(override))
+	for _, meal := range override {
+		overrides[key(meal)] = meal
+	}
+
+	meals := make([]Meal, 0, len(base)+len(override))
+	replaced := make(map[mealKey]bool)
+	var days []string // in the order of `base`
+	dayReplaced := make(map[string]bool)
+	for _, meal := range base {
+		k := key(meal)
+		if o, ok := overrides[k]; ok {
+			if !dayReplaced[k.date] {
+				dayReplaced[k.date] = true
+				days = append(days, k.date)
+			}
+			meal = o
+			replaced[k] = true
+		}
+		meals = append(meals, meal)
+	}
+	for _, meal := range override {
+		if !replaced[key(meal)] {
+			meals = append(meals, meal)
+		}
+	}
+	if len(days) > 0 {
+		log.Printf("overrode the meals of %d days: %s", len(days), strings.Join(days, ", "))
+	}
+	return meals
+}
+
+// menuTable is a table to parse meals from, with where it is in its document.
+type menuTable struct {
+	page, table int // page number and table number on the page, starting at 1
+	cells       stringTable
+}
+
+// mealTables returns the tables of `r` to parse meals from, ordered by page number then table
+// number: its lineTables if it has them, else its pageTables.
+func (r docTables) mealTables() []menuTable {
+	pageTables := r.lineTables
+	if pageTables == nil {
+		pageTables = r.pageTables
+	}
+	var tables []menuTable
+	for _, pageNum := range r.pageNumbers() {
+		for i, cells := range pageTables[pageNum] {
+			tables = append(tables, menuTable{page: pageNum, table: i + 1, cells: cells})
+		}
+	}
+	return tables
+}
+
+// parseMealTable returns the meals in menu table `t` of `month` in `year`, one for each date
+// and meal type with any dishes or a closed-day token of `opts`. Blank and notServedTokens cells
+// have no meal. `t` may have a row for each day, or a column for each day as read by
+// dayColumnTables. Doubtful cells are warned of to `w`.
+func parseMealTable(t stringTable, year int, month time.Month, opts MealOptions, w *mealWarnings) []Meal {
+	blocks, ok := dayColumnTables(t, year, month, w)
+	if !ok {
+		return parseMealRows(t, year, month, opts, w)
+	}
+	var meals []Meal
+	for _, block := range blocks {
+		meals = append(meals, parseMealRows(block, year, month, opts, w)...)
+	}
+	return meals
+}
+
+// parseMealRows returns the meals in menu table `t`, which has a row for each day under a header
+// row of meal types, as for parseMealTable. Rows after the header whose date cell isn't a day,
+// such as repeated headers and totals, are skipped.
+func parseMealRows(t stringTable, year int, month time.Month, opts MealOptions, w *mealWarnings) []Meal {
+	layout, ok := findMealLayout(t)
+	if !ok {
+		return nil
+	}
+	var meals []Meal
+	for _, row := range t[layout.headerRow+1:] {
+		if layout.dateColumn >= len(row) || isTotalRow(row) {
+			continue
+		}
+		dayMonth, day, ok := parseDay(row[layout.dateColumn])
+		// A row of another month's date, like 3/31 in the first week of April, isn't this menu's.
+		if !ok || (dayMonth != 0 && dayMonth != month) {
+			continue
+		}
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+		if date.Month() != month {
+			continue
+		}
+		meals = append(meals, layout.rowMeals(row, date, opts, w)...)
+	}
+	return meals
+}
+
+// dayColumnTables returns the blocks of menu table `t` that have a column for each day, turned
+// into tables with a row for each day that parseMealRows reads. A block starts with a row of
+// dates, as found by mapColumnsToDates, followed by rows labelled in their first cell with a meal
+// type, or with the calories or a nutrient of the meal type above. The meal type rows are found
+// by their labels, so a block may have them in any order or leave some out, e.g. breakfast on
+// weekends; each day's meals are then in row order. A row with a blank label continues the
+// dishes of the row above. ok is false if `t` has no such blocks. Dates of other months are
+// warned of to `w`, as by mapColumnsToDates.
+func dayColumnTables(t stringTable, year int, month time.Month, w *mealWarnings) (blocks []stringTable, ok bool) {
+	var dates map[int]time.Time
+	var rows [][]string // the labelled rows of the current block
+	endBlock := func() {
+		for _, row := range rows {
+			if _, isMeal := headerMealType(row[0]); isMeal {
+				blocks = append(blocks, transposeDayBlock(dates, rows))
+				return
+			}
+		}
+	}
+	for _, row := range t {
+		if columnDates, ok := mapColumnsToDates(row, year, month, w); ok {
+			endBlock()
+			dates, rows = columnDates, nil
+			continue
+		}
+		switch {
+		case dates == nil || len(row) == 0:
+		case row[0] != "":
+			rows = append(rows, append([]string(nil), row...))
+		case len(rows) > 0:
+			last := rows[len(rows)-1]
+			for x, cell := range row {
+				switch {
+				case cell == "":
+				case x >= len(last):
+					last = append(last, make([]string, x+1-len(last))...)
+					last[x] = cell
+				case last[x] == "":
+					last[x] = cell
+				default:
+					last[x] += "\n" + cell
+				}
+			}
+			rows[len(rows)-1] = last
+		}
+	}
+	endBlock()
+	return blocks, len(blocks) > 0
+}
+
+// transposeDayBlock returns a table with a header row of the labels of `rows`, the rows of a
+// block of a menu table with a column for each day, and then a row for each column of `dates`
+// with its day of the month and cells, in column order.
+func transposeDayBlock(dates map[int]time.Time, rows [][]string) stringTable {
+	header := []string{"日付"}
+	for _, row := range rows {
+		header = append(header, row[0])
+	}
+	columns := make([]int, 0, len(dates))
+	for x := range dates {
+		columns = append(columns, x)
+	}
+	sort.Ints(columns)
+	t := stringTable{header}
+	for _, x := range columns {
+		day := []string{strconv.Itoa(dates[x].Day())}
+		for _, row := range rows {
+			cell := ""
+			if x < len(row) {
+				cell = row[x]
+			}
+			day = append(day, cell)
+		}
+		t = append(t, day)
+	}
+	return t
+}
+
+// mapColumnsToDates returns the date of each column of menu table row `row` that gives a day of
+// `month` in `year`, if `row` is a row of dates: its first cell isn't a meal type, calorie or
+// nutrient label, and the cells after it are blank or days as read by parseDay, at least two of
+// them. The days may be bare, like "1日(月)", or M/D, like "4/1"; full-width digits are turned into
+// these by normalize(). A day of another month, like 3/31 in the first week of April, has no date
+// and is warned of to `w`. ok is false if `row` isn't a row of dates.
+func mapColumnsToDates(row []string, year int, month time.Month, w *mealWarnings) (dates map[int]time.Time, ok bool) {
+	if len(row) < 3 || isRowLabel(row[0]) {
+		return nil, false
+	}
+	dates = make(map[int]time.Time)
+	days := 0
+	for x := 1; x < len(row); x++ {
+		if row[x] == "" {
+			continue
+		}
+		dayMonth, day, ok := parseDay(row[x])
+		if !ok {
+			return nil, false
+		}
+		days++
+		if dayMonth != 0 && dayMonth != month {
+			w.warn(warnOtherMonthDate, "date %q in a row of dates isn't in %s, skipping its column", row[x], month)
+			continue
+		}
+		if date := time.Date(year, month, day, 0, 0, 0, 0, time.Local); date.Month() == month {
+			dates[x] = date
+		}
+	}
+	return dates, days >= 2
+}
+
+// isRowLabel returns true if `cell` labels the dishes, calories or a nutrient of a meal type.
+func isRowLabel(cell string) bool {
+	_, isMeal := headerMealType(cell)
+	_, isNutrient := headerNutrient(cell)
+	return isMeal || isNutrient || isCalorieHeader(cell)
+}
+
+// mealLayout is where the parts of the meals are in a menu table.
+type mealLayout struct {
+	headerRow  int              // row with the column headers
+	dateColumn int              // column with the day of the month
+	meals      map[int]MealType // columns with the dishes of each meal type
+	calories   map[int]MealType // カロリー columns, with the meal type each is for
+	nutrients  map[int]nutrientColumn
+}
+
+// nutrientColumn is a column of one nutrient's figures for one meal type.
+type nutrientColumn struct {
+	mealType MealType
+	nutrient nutrient
+}
+
+// findMealLayout returns the layout of menu table `t`. The header row is the first row with meal
+// type headers. The date column is the one headed 日付 or similar, or else the first column. A
+// calorie or nutrient column is for the meal type in its header, or else for the nearest meal
+// column to its left. ok is false if `t` has no meal type headers.
+func findMealLayout(t stringTable) (layout mealLayout, ok bool) {
+	for y, row := range t {
+		layout = mealLayout{
+			headerRow:  y,
+			dateColumn: -1,
+			meals:      make(map[int]MealType),
+			calories:   make(map[int]MealType),
+			nutrients:  make(map[int]nutrientColumn),
+		}
+		var lastMeal MealType
+		for x, cell := range row {
+			mealType, isMeal := headerMealType(cell)
+			nutrient, isNutrient := headerNutrient(cell)
+			switch {
+			case isCalorieHeader(cell):
+				if !isMeal {
+					mealType = lastMeal
+				}
+				if mealType != 0 {
+					layout.calories[x] = mealType
+				}
+			case isNutrient:
+				if !isMeal {
+					mealType = lastMeal
+				}
+				if mealType != 0 {
+					layout.nutrients[x] = nutrientColumn{mealType, nutrient}
+				}
+			case isMeal:
+				layout.meals[x] = mealType
+				lastMeal = mealType
+			case layout.dateColumn < 0 && strings.Contains(cell, "日"):
+				layout.dateColumn = x
+			}
+		}
+		if len(layout.meals) > 0 {
+			if layout.dateColumn < 0 {
+				layout.dateColumn = 0
+			}
+			return layout, true
+		}
+	}
+	return mealLayout{}, false
+}
+
+// rowMeals returns the meals on `date` in menu table row `row`, in column order, read as
+// controlled by `opts`. Calories given as a range and calorie or nutrient cells that aren't
+// figures are warned of to `w`.
+func (layout mealLayout) rowMeals(row []string, date time.Time, opts MealOptions, w *mealWarnings) []Meal {
+	day := date.Format("2006-01-02")
+	var meals []Meal
+	index := make(map[MealType]int)
+	for x, cell := range row {
+		mealType, ok := layout.meals[x]
+		if !ok {
+			continue
+		}
+		meal, ok := parseMealCell(cell, opts)
+		if !ok {
+			continue
+		}
+		if m := reCalories.FindStringSubmatch(cell); m != nil && m[2] != "" {
+			w.warn(warnCalorieRange, "%s %s calories %q are a range, not recorded", day, mealType, m[0])
+		}
+		meal.Date = date
+		meal.Type = mealType
+		index[mealType] = len(meals)
+		meals = append(meals, meal)
+	}
+	for x, cell := range row {
+		mealType, ok := layout.calories[x]
+		if !ok {
+			continue
+		}
+		i, ok := index[mealType]
+		if !ok || meals[i].CaloriesOK {
+			continue
+		}
+		meals[i].Calories, meals[i].CaloriesOK = parseCalorieCell(cell)
+		switch m := reCalories.FindStringSubmatch(cell); {
+		case meals[i].CaloriesOK, cell == "", isToken(cell, notServedTokens):
+		case m != nil && m[2] != "":
+			w.warn(warnCalorieRange, "%s %s calories %q are a range, not recorded", day, mealType, m[0])
+		default:
+			w.warn(warnUnreadableCalories, "%s %s calories %q aren't a figure", day, mealType, cell)
+		}
+	}
+	for i := range meals {
+		meals[i].Calories = opts.calories(meals[i].Calories)
+	}
+	for x, cell := range row {
+		column, ok := layout.nutrients[x]
+		if !ok {
+			continue
+		}
+		i, ok := index[column.mealType]
+		if !ok {
+			continue
+		}
+		if grams, ok := parseGramsCell(cell); ok {
+			meals[i].Nutrition.set(column.nutrient, grams)
+		} else if cell != "" && !isToken(cell, notServedTokens) {
+			w.warn(warnUnreadableNutrient, "%s %s %s %q isn't a figure", day, column.mealType, column.nutrient, cell)
+		}
+	}
+	return meals
+}
+
+// parseMealCell returns the meal in meal cell `cell`, without its date and type. Figures like
+// "650kcal" and "脂質20g" in the cell are taken as the meal's calories and nutrition, and an event
+// marker like "【誕生日メニュー】" as its Event, rather than dishes. ok is false if the cell is blank
+// or one of notServedTokens.
+func parseMealCell(cell string, opts MealOptions) (meal Meal, ok bool) {
+	if m := reCalories.FindStringSubmatchIndex(cell); m != nil {
+		meal.Calories, meal.CaloriesOK = caloriesValue(cell[m[2]:m[3]], m[4] >= 0)
+		cell = cell[:m[0]] + " " + cell[m[1]:]
+	}
+	cell = takeNutrientLabels(cell, &meal.Nutrition)
+	items := mealItems(cell)
+	switch {
+	case len(items) == 0, len(items) == 1 && isToken(items[0], notServedTokens):
+		return Meal{}, false
+	case isToken(items[0], opts.closedTokens()):
+		return Meal{Closed: true}, true
+	}
+	meal.Event, meal.Items = takeEvent(items)
+	for i, item := range meal.Items {
+		dish := parseItem(item)
+		meal.Items[i] = dish.Name
+		meal.Dishes = append(meal.Dishes, dish)
+	}
+	return meal, true
+}
+
+// parseItem returns dish `item` with its weight taken out of the name, e.g. "ごはん" and 200 for
+// "ごはん 200g" or "ごはん(200g)". An item without a weight, or that is only a weight, is all name.
+func parseItem(item string) Item {
+	m := reItemGrams.FindStringSubmatch(item)
+	if m == nil {
+		return Item{Name: item}
+	}
+	grams, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return Item{Name: item}
+	}
+	return Item{Name: m[1], Grams: grams}
+}
+
+// reItemGrams matches a dish with a weight after its name, which doesn't end with a digit. "ｇ" and
+// "㌘" are turned into "g" and "グラム" by normalize().
+var reItemGrams = regexp.MustCompile(`^(\S.*?[^\d.\s])\s*\(?\s*(\d+(?:\.\d+)?)\s*(?:g|グラム)\s*\)?$`)
+
+// eventMenus are the event markers that don't end with "メニュー".
+var eventMenus = []string{"行事食", "バイキング", "セレクト給食"}
+
+// takeEvent returns the first event marker in dishes `items`, as for eventName(), and `items`
+// without the markers. A marker may be a line of its own, like "★誕生日メニュー★", or a bracketed
+// prefix of a dish, like "【誕生日メニュー】ステーキ".
+func takeEvent(items []string) (event string, dishes []string) {
+	for _, item := range items {
+		name, dish := item, ""
+		if m := reBracketPrefix.FindStringSubmatch(item); m != nil {
+			name, dish = m[1], m[2]
+		}
+		if name, ok := eventName(name); ok {
+			if event == "" {
+				event = name
+			}
+			if dish != "" {
+				dishes = append(dishes, dish)
+			}
+			continue
+		}
+		dishes = append(dishes, item)
+	}
+	return event, dishes
+}
+
+// eventName returns `text` without its decorations, like the stars of "★七夕メニュー★", if it is an
+// event marker: a name ending with "メニュー", like "誕生日メニュー", or one of eventMenus. A dish
+// like "誕生日ケーキ" isn't a marker.
+func eventName(text string) (string, bool) {
+	name := strings.TrimSpace(strings.Trim(text, eventDecorations))
+	if strings.HasSuffix(name, "メニュー") && name != "メニュー" {
+		return name, true
+	}
+	for _, menu := range eventMenus {
+		if name == menu {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// eventDecorations are the symbols around event markers, after normalize().
+const eventDecorations = "★☆◆◇●○♪!~ 【】〈〉《》「」『』<>[]()"
+
+// reBracketPrefix matches a dish line starting with a bracketed label, e.g. "【誕生日メニュー】ステーキ",
+// giving the label and the rest. "＜＞" and "（）" are turned into "<>" and "()" by normalize().
+var reBracketPrefix = regexp.MustCompile(`^[★☆◆◇●○]*\s*[【〈《「『<\[(]([^】〉》」』>\])]+)[】〉》」』>\])]\s*(.*)$`)
+
+// headerMealType returns the meal type of column header `cell`, e.g. Breakfast for "朝食" or "朝".
+func headerMealType(cell string) (MealType, bool) {
+	for _, h := range mealTypeHeaders {
+		if strings.Contains(cell, h.header) || cell == h.short {
+			return h.mealType, true
+		}
+	}
+	return 0, false
+}
+
+// isTotalRow returns true if `row` is a totals or averages row rather than a day.
+func isTotalRow(row []string) bool {
+	for _, cell := range row {
+		if strings.Contains(cell, "合計") || strings.Contains(cell, "平均") {
+			return true
+		}
+	}
+	return false
+}
+
+// mealItems returns the dishes in meal cell `cell`, one per line. A dish name may contain spaces,
+// e.g. "鶏の唐揚げ 甘酢あんかけ", so a cell without line breaks is one dish.
+func mealItems(cell string) []string {
+	var items []string
+	for _, line := range strings.Split(cell, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// isToken returns true if `item` is one of `tokens`.
+func isToken(item string, tokens []string) bool {
+	for _, token := range tokens {
+		if item == token {
+			return true
+		}
+	}
+	return false
+}
+
+// isCalorieHeader returns true if column header `cell` is for calories.
+func isCalorieHeader(cell string) bool {
+	return strings.Contains(cell, "カロリー") || strings.Contains(cell, "エネルギー") ||
+		strings.Contains(strings.ToLower(cell), "kcal")
+}
+
+// parseCalorieCell returns the calories in calorie column cell `cell`, which may be a bare number
+// like "650" or a figure like "650kcal". ok is false if it is blank or a range.
+func parseCalorieCell(cell string) (kcal float64, ok bool) {
+	if m := reCalories.FindStringSubmatch(cell); m != nil {
+		return caloriesValue(m[1], m[2] != "")
+	}
+	if reNumber.MatchString(cell) {
+		return caloriesValue(cell, false)
+	}
+	return 0, false
+}
+
+// caloriesValue returns number `text` as kcal. A `isRange` figure, like the 600 of "600~700kcal",
+// gives 0 and false.
+func caloriesValue(text string, isRange bool) (float64, bool) {
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || isRange {
+		return 0, false
+	}
+	return value, true
+}
+
+// reCalories matches a calorie figure, e.g. "650kcal", "650 kcal" or the range "600~700kcal". The
+// menus' full-width "６５０ｋｃａｌ" and "㎉" are turned into these forms by normalize().
+var reCalories = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)(?:\s*[-~〜]\s*(\d+(?:\.\d+)?))?\s*kcal`)
+
+// reNumber matches a cell that is just a number.
+var reNumber = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+
+// parseDay returns the month and day in date cell `cell`, e.g. 0 and 4 for "4日(木)", and 4 and 4
+// for "4/4" or "4月4日". The month is 0 if the cell gives only the day. ok is false if `cell`
+// doesn't start with a day from 1 to 31, or gives a month that isn't from 1 to 12.
+func parseDay(cell string) (month time.Month, day int, ok bool) {
+	m := reDay.FindStringSubmatch(cell)
+	if m == nil {
+		return 0, 0, false
+	}
+	day, _ = strconv.Atoi(m[2])
+	if day < 1 || day > 31 {
+		return 0, 0, false
+	}
+	if m[1] != "" {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > 12 {
+			return 0, 0, false
+		}
+		month = time.Month(n)
+	}
+	return month, day, true
+}
+
+// reDay matches the day at the start of a date cell, after an optional month.
+var reDay = regexp.MustCompile(`^(?:(\d{1,2})\s*[/月]\s*)?(\d{1,2})(?:\D|$)`)
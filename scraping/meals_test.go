@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMealItems(t *testing.T) {
+	tests := []struct {
+		cell string
+		want []string
+	}{
+		{"", nil},
+		{"ご飯", []string{"ご飯"}},
+		{"鶏の唐揚げ 甘酢あんかけ", []string{"鶏の唐揚げ 甘酢あんかけ"}},
+		{"ご飯\n鶏の唐揚げ 甘酢あんかけ\n味噌汁", []string{"ご飯", "鶏の唐揚げ 甘酢あんかけ", "味噌汁"}},
+		{"ご飯\n \n味噌汁\n", []string{"ご飯", "味噌汁"}},
+	}
+	for _, tc := range tests {
+		if got := mealItems(tc.cell); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("mealItems(%q) = %q, want %q", tc.cell, got, tc.want)
+		}
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	tests := []struct {
+		cell  string
+		month time.Month
+		day   int
+		ok    bool
+	}{
+		{"4", 0, 4, true},
+		{"4日(木)", 0, 4, true},
+		{"12日", 0, 12, true},
+		{"4/1", time.April, 1, true},
+		{"3/30(土)", time.March, 30, true},
+		{"4月4日", time.April, 4, true},
+		{normalize("４／１５"), time.April, 15, true},
+		{"13/1", 0, 0, false},
+		{"32日", 0, 0, false},
+		{"0", 0, 0, false},
+		{"123", 0, 0, false},
+		{"日付", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tc := range tests {
+		month, day, ok := parseDay(tc.cell)
+		if month != tc.month || day != tc.day || ok != tc.ok {
+			t.Errorf("parseDay(%q) = %d, %d, %v, want %d, %d, %v",
+				tc.cell, month, day, ok, tc.month, tc.day, tc.ok)
+		}
+	}
+}
+
+// mealSummary is the date, type and items of a Meal, for comparing parse results.
+type mealSummary struct {
+	date  string
+	typ   MealType
+	items []string
+}
+
+func summarizeMeals(meals []Meal) []mealSummary {
+	var got []mealSummary
+	for _, m := range meals {
+		got = append(got, mealSummary{m.Date.Format("2006-01-02"), m.Type, m.Items})
+	}
+	return got
+}
+
+func TestParseMealTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table stringTable
+		want  []mealSummary
+	}{
+		{
+			name: "dishes on separate lines",
+			table: stringTable{
+				{"日付", "朝食", "夕食"},
+				{"1日(月)", "ご飯\n味噌汁", "鶏の唐揚げ 甘酢あんかけ\nサラダ"},
+			},
+			want: []mealSummary{
+				{"2024-04-01", Breakfast, []string{"ご飯", "味噌汁"}},
+				{"2024-04-01", Dinner, []string{"鶏の唐揚げ 甘酢あんかけ", "サラダ"}},
+			},
+		},
+		{
+			name: "title row, repeated header and totals",
+			table: stringTable{
+				{"4月の献立", "", ""},
+				{"日付", "朝食", "夕食"},
+				{"2", "パン", "うどん"},
+				{"日付", "朝食", "夕食"},
+				{"合計", "1200", "1500"},
+			},
+			want: []mealSummary{
+				{"2024-04-02", Breakfast, []string{"パン"}},
+				{"2024-04-02", Dinner, []string{"うどん"}},
+			},
+		},
+		{
+			name: "M/D dates of the neighbouring months are skipped",
+			table: stringTable{
+				{"月日", "朝", "夕"},
+				{"3/31", "ご飯", "カレー"},
+				{"4/1", "パン", "うどん"},
+				{"5/1", "粥", "そば"},
+			},
+			want: []mealSummary{
+				{"2024-04-01", Breakfast, []string{"パン"}},
+				{"2024-04-01", Dinner, []string{"うどん"}},
+			},
+		},
+		{
+			name: "days past the end of the month are skipped",
+			table: stringTable{
+				{"日", "昼食"},
+				{"30", "ラーメン"},
+				{"31", "チャーハン"},
+			},
+			want: []mealSummary{
+				{"2024-04-30", Lunch, []string{"ラーメン"}},
+			},
+		},
+		{
+			name:  "no meal headers",
+			table: stringTable{{"a", "b"}, {"1", "2"}},
+			want:  nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := summarizeMeals(parseMealTable(tc.table, 2024, time.April, MealOptions{}, nil))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMealsUsesLineTables(t *testing.T) {
+	r := docTables{
+		pageTables: map[int][]stringTable{1: {{{"日付", "夕食"}, {"1", "ご飯 味噌汁"}}}},
+		lineTables: map[int][]stringTable{1: {{{"日付", "夕食"}, {"1", "ご飯\n味噌汁"}}}},
+		year:       2024,
+		month:      time.April,
+	}
+	meals, _, err := ParseMeals(r, MealOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mealSummary{{"2024-04-01", Dinner, []string{"ご飯", "味噌汁"}}}
+	if got := summarizeMeals(meals); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMealsJSONSourceURL(t *testing.T) {
+	const url = "https://www.off.niihama-nct.ac.jp/gakuryo-a/kondate/2024PDF/apr.pdf"
+	r := docTables{
+		pageTables: map[int][]stringTable{1: {{{"日付", "夕食"}, {"1", "カレー"}}}},
+		year:       2024,
+		month:      time.April,
+		sourceURL:  url,
+	}
+	meals, _, err := ParseMeals(r, MealOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if err := WriteMealsJSON(b, meals, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"2024-04":[{"date":"2024-04-01","type":"dinner","items":["カレー"],"source":"` + url + `"}]}` + "\n"
+	if b.String() != want {
+		t.Errorf("WriteMealsJSON =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestNormalizeLines(t *testing.T) {
+	if got, want := normalizeLines("ご飯\n\n  鶏の唐揚げ　甘酢あんかけ \n"), "ご飯\n鶏の唐揚げ 甘酢あんかけ"; got != want {
+		t.Errorf("normalizeLines = %q, want %q", got, want)
+	}
+}
+
+func TestParseMealCellClosedAndNotServed(t *testing.T) {
+	tests := []struct {
+		name   string
+		cell   string
+		opts   MealOptions
+		ok     bool
+		closed bool
+		items  []string
+	}{
+		{"dishes", "ご飯\n味噌汁", MealOptions{}, true, false, []string{"ご飯", "味噌汁"}},
+		{"blank", "", MealOptions{}, false, false, nil},
+		{"closed", "休", MealOptions{}, true, true, nil},
+		{"closed with a note", "休業\n(祝日)", MealOptions{}, true, true, nil},
+		{"dash is not served", "-", MealOptions{}, false, false, nil},
+		{"full-width dash", normalize("－"), MealOptions{}, false, false, nil},
+		{"dish starting with 休 text", "休日カレー", MealOptions{}, true, false, []string{"休日カレー"}},
+		{"custom token", "お休み", MealOptions{ClosedTokens: []string{"お休み"}}, true, true, nil},
+		{"default token not in custom list", "休", MealOptions{ClosedTokens: []string{"お休み"}}, true, false, []string{"休"}},
+		{"empty custom list", "休", MealOptions{ClosedTokens: []string{}}, true, false, []string{"休"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			meal, ok := parseMealCell(tc.cell, tc.opts)
+			if ok != tc.ok || meal.Closed != tc.closed || !reflect.DeepEqual(meal.Items, tc.items) {
+				t.Errorf("parseMealCell(%q) = %+v, %v, want Closed=%v Items=%q, %v",
+					tc.cell, meal, ok, tc.closed, tc.items, tc.ok)
+			}
+		})
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	if got, want := splitTokens(" 休, 休業 ,,Ｃｌｏｓｅｄ"), []string{"休", "休業", "Closed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitTokens = %q, want %q", got, want)
+	}
+	if got := splitTokens(""); got == nil || len(got) != 0 {
+		t.Errorf("splitTokens(\"\") = %#v, want an empty, non-nil list", got)
+	}
+}
+
+func TestMealMarshalJSON(t *testing.T) {
+	// A date late in the day in a zone east of UTC must keep its local date.
+	jst := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		meal Meal
+		want string
+	}{
+		{Meal{Date: time.Date(2024, 4, 1, 23, 30, 0, 0, jst), Type: Breakfast, Items: []string{"ご飯", "味噌汁"},
+			Calories: 650, CaloriesOK: true, Nutrition: Nutrition{Protein: 20.5}},
+			`{"date":"2024-04-01","type":"breakfast","items":["ご飯","味噌汁"],"calories":650,"nutrition":{"protein":20.5}}`},
+		{Meal{Date: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), Type: Dinner, Closed: true},
+			`{"date":"2024-12-31","type":"dinner","closed":true}`},
+	}
+	for _, tc := range tests {
+		got, err := json.Marshal(tc.meal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("json.Marshal(%+v) =\n%s\nwant\n%s", tc.meal, got, tc.want)
+		}
+	}
+}
+
+func TestWriteMealsJSONByMonth(t *testing.T) {
+	meals := []Meal{
+		{Date: time.Date(2024, 4, 30, 0, 0, 0, 0, time.Local), Type: Dinner, Items: []string{"カレー&サラダ"}},
+		{Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), Type: Breakfast, Items: []string{"パン"}},
+	}
+	b := new(bytes.Buffer)
+	if err := WriteMealsJSON(b, meals, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"2024-04":[{"date":"2024-04-30","type":"dinner","items":["カレー&サラダ"]}],` +
+		`"2024-05":[{"date":"2024-05-01","type":"breakfast","items":["パン"]}]}` + "\n"
+	if b.String() != want {
+		t.Errorf("WriteMealsJSON =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestWriteMealsJSONCompactAndPretty(t *testing.T) {
+	meals := []Meal{
+		{Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local), Type: Lunch, Items: []string{"<日替わり>定食"},
+			Calories: 800, CaloriesOK: true},
+	}
+	var compact, pretty bytes.Buffer
+	if err := WriteMealsJSON(&compact, meals, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMealsJSON(&pretty, meals, true); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCompact := `{"2024-04":[{"date":"2024-04-01","type":"lunch","items":["<日替わり>定食"],"calories":800}]}` + "\n"
+	if compact.String() != wantCompact {
+		t.Errorf("compact =\n%s\nwant\n%s", compact.String(), wantCompact)
+	}
+	wantPretty := `{
+  "2024-04": [
+    {
+      "date": "2024-04-01",
+      "type": "lunch",
+      "items": [
+        "<日替わり>定食"
+      ],
+      "calories": 800
+    }
+  ]
+}
+`
+	if pretty.String() != wantPretty {
+		t.Errorf("pretty =\n%s\nwant\n%s", pretty.String(), wantPretty)
+	}
+
+	// Both encode the same value.
+	var fromCompact, fromPretty any
+	if err := json.Unmarshal(compact.Bytes(), &fromCompact); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(pretty.Bytes(), &fromPretty); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromCompact, fromPretty) {
+		t.Errorf("compact and pretty JSON differ: %v vs %v", fromCompact, fromPretty)
+	}
+}
+
+func TestParseMealTableDayColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		table stringTable
+		want  []mealSummary
+	}{
+		{
+			name: "weekend block omits breakfast",
+			table: stringTable{
+				{"", "1日(月)", "2日(火)"},
+				{"", "月", "火"},
+				{"朝食", "ご飯", "パン"},
+				{"昼食", "うどん", "そば"},
+				{"夕食", "カレー", "焼き魚"},
+				{"", "6日(土)", "7日(日)"},
+				{"昼食", "ラーメン", "休"},
+				{"夕食", "丼", "休"},
+			},
+			want: []mealSummary{
+				{"2024-04-01", Breakfast, []string{"ご飯"}},
+				{"2024-04-01", Lunch, []string{"うどん"}},
+				{"2024-04-01", Dinner, []string{"カレー"}},
+				{"2024-04-02", Breakfast, []string{"パン"}},
+				{"2024-04-02", Lunch, []string{"そば"}},
+				{"2024-04-02", Dinner, []string{"焼き魚"}},
+				{"2024-04-06", Lunch, []string{"ラーメン"}},
+				{"2024-04-06", Dinner, []string{"丼"}},
+				{"2024-04-07", Lunch, nil},
+				{"2024-04-07", Dinner, nil},
+			},
+		},
+		{
+			name: "reordered rows with calories",
+			table: stringTable{
+				{"日付", "8", "9", "10"},
+				{"夕食", "ハンバーグ", "", "鍋"},
+				{"エネルギー", "850", "", "790"},
+				{"朝", "納豆", "卵", "-"},
+				{"昼", "カツ丼", "パスタ", "ピラフ"},
+			},
+			// Each day's meals are in row order.
+			want: []mealSummary{
+				{"2024-04-08", Dinner, []string{"ハンバーグ"}},
+				{"2024-04-08", Breakfast, []string{"納豆"}},
+				{"2024-04-08", Lunch, []string{"カツ丼"}},
+				{"2024-04-09", Breakfast, []string{"卵"}},
+				{"2024-04-09", Lunch, []string{"パスタ"}},
+				{"2024-04-10", Dinner, []string{"鍋"}},
+				{"2024-04-10", Lunch, []string{"ピラフ"}},
+			},
+		},
+		{
+			name: "blank labels continue the dishes above",
+			table: stringTable{
+				{"", "15", "16"},
+				{"夕食", "ご飯", "ご飯"},
+				{"", "味噌汁", ""},
+				{"", "生姜焼き", "焼きそば"},
+			},
+			want: []mealSummary{
+				{"2024-04-15", Dinner, []string{"ご飯", "味噌汁", "生姜焼き"}},
+				{"2024-04-16", Dinner, []string{"ご飯", "焼きそば"}},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := summarizeMeals(parseMealTable(tc.table, 2024, time.April, MealOptions{}, nil))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMealTableDayColumnCalories(t *testing.T) {
+	table := stringTable{
+		{"", "1", "2"},
+		{"昼食", "定食", "麺"},
+		{"夕食", "カレー", "丼"},
+		{"エネルギー", "900", "850"},
+	}
+	meals := parseMealTable(table, 2024, time.April, MealOptions{}, nil)
+	var got []string
+	for _, m := range meals {
+		got = append(got, fmt.Sprintf("%s %s %g %v", m.Date.Format("01-02"), m.Type, m.Calories, m.CaloriesOK))
+	}
+	want := []string{"04-01 lunch 0 false", "04-01 dinner 900 true", "04-02 lunch 0 false", "04-02 dinner 850 true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMapColumnsToDates(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	tests := []struct {
+		name string
+		row  []string
+		want map[int]time.Time
+		ok   bool
+		warn bool
+	}{
+		{"bare days", []string{"日付", "1日(月)", "2日(火)", "", "4"}, map[int]time.Time{1: day(1), 2: day(2), 4: day(4)}, true, false},
+		{"M/D", []string{"", "4/1(月)", "4/2(火)"}, map[int]time.Time{1: day(1), 2: day(2)}, true, false},
+		{"full-width M/D", []string{"", normalize("４／２９"), normalize("４／３０")}, map[int]time.Time{1: day(29), 2: day(30)}, true, false},
+		{"M/D of another month", []string{"", "3/31", "4/1"}, map[int]time.Time{2: day(1)}, true, true},
+		{"past the end of the month", []string{"", "30", "31"}, map[int]time.Time{1: day(30)}, true, false},
+		{"one day", []string{"", "1", ""}, nil, false, false},
+		{"dishes", []string{"", "1日", "ご飯"}, nil, false, false},
+		{"nutrient figures", []string{"たんぱく質", "25.3", "20.1"}, nil, false, false},
+		{"meal row", []string{"朝食", "1", "2"}, nil, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+			got, ok := mapColumnsToDates(tc.row, 2024, time.April, nil)
+			if ok != tc.ok || (ok && !reflect.DeepEqual(got, tc.want)) {
+				t.Errorf("mapColumnsToDates(%q) = %v, %v, want %v, %v", tc.row, got, ok, tc.want, tc.ok)
+			}
+			if warned := strings.Contains(logs.String(), "warning:"); warned != tc.warn {
+				t.Errorf("warned = %v, want %v; log: %s", warned, tc.warn, logs)
+			}
+		})
+	}
+}
+
+func TestParseMealTableMDHeaderRow(t *testing.T) {
+	captureLog(t)
+	table := stringTable{
+		{"", "3/31(日)", "4/1(月)"},
+		{"夕食", "カレー", "うどん"},
+	}
+	want := []mealSummary{{"2024-04-01", Dinner, []string{"うどん"}}}
+	if got := summarizeMeals(parseMealTable(table, 2024, time.April, MealOptions{}, nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseMealCellEvent(t *testing.T) {
+	tests := []struct {
+		cell  string
+		event string
+		items []string
+	}{
+		{"ご飯\n味噌汁", "", []string{"ご飯", "味噌汁"}},
+		{"誕生日ケーキ\nご飯", "", []string{"誕生日ケーキ", "ご飯"}},
+		{"★誕生日メニュー★\nステーキ\nケーキ", "誕生日メニュー", []string{"ステーキ", "ケーキ"}},
+		{normalize("【誕生日メニュー】ステーキ") + "\nケーキ", "誕生日メニュー", []string{"ステーキ", "ケーキ"}},
+		{normalize("＜七夕メニュー＞") + "\nそうめん", "七夕メニュー", []string{"そうめん"}},
+		{"行事食\nちらし寿司", "行事食", []string{"ちらし寿司"}},
+		{"[行事食] ちらし寿司", "行事食", []string{"ちらし寿司"}},
+		{"【大盛】カレー", "", []string{"【大盛】カレー"}},
+		{"メニュー", "", []string{"メニュー"}},
+	}
+	for _, tc := range tests {
+		meal, ok := parseMealCell(tc.cell, MealOptions{})
+		if !ok || meal.Event != tc.event || !reflect.DeepEqual(meal.Items, tc.items) {
+			t.Errorf("parseMealCell(%q) = Event %q, Items %q, %v, want %q, %q", tc.cell, meal.Event, meal.Items, ok, tc.event, tc.items)
+		}
+	}
+}
+
+func TestRoundCalories(t *testing.T) {
+	table := stringTable{
+		{"日付", "昼食", "夕食", "エネルギー"},
+		{"1", "定食 647kcal", "カレー", "812.6"},
+	}
+	tests := []struct {
+		opts MealOptions
+		want []float64
+	}{
+		{MealOptions{}, []float64{647, 812.6}},
+		{MealOptions{RoundCalories: true}, []float64{650, 810}},
+	}
+	for _, tc := range tests {
+		var got []float64
+		for _, m := range parseMealTable(table, 2024, time.April, tc.opts, nil) {
+			if !m.CaloriesOK {
+				t.Fatalf("%s has no calories", m.Type)
+			}
+			got = append(got, m.Calories)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("RoundCalories %v: calories = %v, want %v", tc.opts.RoundCalories, got, tc.want)
+		}
+	}
+}
+
+func TestParseMealCellItemWeights(t *testing.T) {
+	tests := []struct {
+		cell   string
+		items  []string
+		dishes []Item
+	}{
+		{"ごはん\n味噌汁", []string{"ごはん", "味噌汁"}, []Item{{"ごはん", 0}, {"味噌汁", 0}}},
+		{normalize("ごはん ２００ｇ") + "\n" + normalize("鮭の塩焼き（８０ｇ）"),
+			[]string{"ごはん", "鮭の塩焼き"}, []Item{{"ごはん", 200}, {"鮭の塩焼き", 80}}},
+		{normalize("豚汁 150㌘") + "\n漬物", []string{"豚汁", "漬物"}, []Item{{"豚汁", 150}, {"漬物", 0}}},
+		{"食パン 2.5g\n100g\n牛乳 200ml", []string{"食パン", "100g", "牛乳 200ml"},
+			[]Item{{"食パン", 2.5}, {"100g", 0}, {"牛乳 200ml", 0}}},
+	}
+	for _, tc := range tests {
+		meal, ok := parseMealCell(tc.cell, MealOptions{})
+		if !ok || !reflect.DeepEqual(meal.Items, tc.items) || !reflect.DeepEqual(meal.Dishes, tc.dishes) {
+			t.Errorf("parseMealCell(%q) = Items %q, Dishes %v, want %q, %v", tc.cell, meal.Items, meal.Dishes, tc.items, tc.dishes)
+		}
+	}
+}
+
+func TestMealMarshalJSONDishes(t *testing.T) {
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	withWeights := Meal{Date: day, Type: Lunch, Items: []string{"ごはん", "漬物"}, Dishes: []Item{{"ごはん", 200}, {"漬物", 0}}}
+	withoutWeights := Meal{Date: day, Type: Lunch, Items: []string{"漬物"}, Dishes: []Item{{"漬物", 0}}}
+	for meal, want := range map[*Meal]string{
+		&withWeights:    `{"date":"2024-04-01","type":"lunch","items":["ごはん","漬物"],"dishes":[{"name":"ごはん","grams":200},{"name":"漬物"}]}`,
+		&withoutWeights: `{"date":"2024-04-01","type":"lunch","items":["漬物"]}`,
+	} {
+		got, err := json.Marshal(*meal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("json.Marshal = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestReconcileMeals(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	base := []Meal{
+		{Date: day(1), Type: Lunch, Items: []string{"カレー"}},
+		{Date: day(1), Type: Dinner, Items: []string{"うどん"}},
+		{Date: day(2), Type: Lunch, Items: []string{"そば"}},
+		{Date: day(2), Type: Dinner, Items: []string{"焼き魚"}},
+		{Date: day(3), Type: Lunch, Items: []string{"丼"}},
+	}
+	override := []Meal{
+		{Date: day(2), Type: Dinner, Items: []string{"ハンバーグ"}},
+		{Date: day(3), Type: Lunch, Closed: true},
+		{Date: day(3), Type: Dinner, Items: []string{"鍋"}},
+	}
+	logs := captureLog(t)
+	got := summarizeMeals(reconcileMeals(base, override))
+	want := []mealSummary{
+		{"2024-04-01", Lunch, []string{"カレー"}},
+		{"2024-04-01", Dinner, []string{"うどん"}},
+		{"2024-04-02", Lunch, []string{"そば"}},
+		{"2024-04-02", Dinner, []string{"ハンバーグ"}},
+		{"2024-04-03", Lunch, nil},
+		{"2024-04-03", Dinner, []string{"鍋"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if !strings.Contains(logs.String(), "2 days: 2024-04-02, 2024-04-03") {
+		t.Errorf("log doesn't name the overridden days: %s", logs)
+	}
+
+	logs.Reset()
+	if got := reconcileMeals(base, nil); len(got) != len(base) {
+		t.Errorf("reconcileMeals(base, nil) has %d meals, want %d", len(got), len(base))
+	}
+	if logs.Len() != 0 {
+		t.Errorf("logged %q with nothing overridden", logs)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mergeByHeader returns the rows of `tables` concatenated into one table under their shared first
+// (header) row. It returns an error if the tables don't all have identical headers or if any row
+// is a different width from the header, so the result is always rectangular.
+func mergeByHeader(tables []stringTable) (stringTable, error) {
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("mergeByHeader: no tables")
+	}
+	var header []string
+	var merged stringTable
+	for i, table := range tables {
+		if len(table) == 0 {
+			return nil, fmt.Errorf("mergeByHeader: table %d is empty", i+1)
+		}
+		if header == nil {
+			header = table[0]
+			merged = append(merged, header)
+		} else if !sameRow(header, table[0]) {
+			return nil, fmt.Errorf("mergeByHeader: table %d header [%s] differs from [%s]",
+				i+1, strings.Join(table[0], ", "), strings.Join(header, ", "))
+		}
+		for y, row := range table[1:] {
+			if len(row) != len(header) {
+				return nil, fmt.Errorf("mergeByHeader: table %d row[%d]=%d cells, header has %d",
+					i+1, y+1, len(row), len(header))
+			}
+			merged = append(merged, row)
+		}
+	}
+	return merged, nil
+}
+
+// sameRow returns true if rows `a` and `b` have the same cells.
+func sameRow(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeByHeader(t *testing.T) {
+	header := []string{"日付", "朝食", "夕食"}
+	week1 := stringTable{header, {"4/1", "パン", "カレー"}, {"4/2", "ご飯", "うどん"}}
+	week2 := stringTable{header, {"4/8", "パン", "そば"}}
+	headerOnly := stringTable{header}
+
+	got, err := mergeByHeader([]stringTable{week1, headerOnly, week2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := stringTable{
+		header,
+		{"4/1", "パン", "カレー"},
+		{"4/2", "ご飯", "うどん"},
+		{"4/8", "パン", "そば"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeByHeader =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMergeByHeaderErrors(t *testing.T) {
+	header := []string{"日付", "朝食", "夕食"}
+	tests := []struct {
+		name   string
+		tables []stringTable
+		want   string
+	}{
+		{"no tables", nil, "no tables"},
+		{"empty table", []stringTable{{header}, {}}, "table 2 is empty"},
+		{"different header", []stringTable{
+			{header, {"4/1", "パン", "カレー"}},
+			{{"日付", "朝食", "昼食"}, {"4/8", "パン", "そば"}},
+		}, "table 2 header [日付, 朝食, 昼食] differs"},
+		{"header with a missing column", []stringTable{
+			{header},
+			{{"日付", "朝食"}},
+		}, "table 2 header"},
+		{"ragged row", []stringTable{
+			{header, {"4/1", "パン"}},
+		}, "table 1 row[1]=2 cells, header has 3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergeByHeader(tc.tables)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("mergeByHeader = %v, %v, want an error containing %q", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Nutrition is the nutrition figures of a meal, in grams. Figures that the menu doesn't give are 0.
+type Nutrition struct {
+	Protein float64 `json:"protein,omitempty"`
+	Fat     float64 `json:"fat,omitempty"`
+	Carbs   float64 `json:"carbs,omitempty"`
+	Salt    float64 `json:"salt,omitempty"` // salt equivalent (食塩相当量)
+}
+
+// nutrient is one of the figures in Nutrition.
+type nutrient int
+
+const (
+	protein nutrient = iota + 1
+	fat
+	carbs
+	salt
+)
+
+// String returns the JSON name of `n`'s figure in Nutrition, e.g. "protein".
+func (n nutrient) String() string {
+	switch n {
+	case protein:
+		return "protein"
+	case fat:
+		return "fat"
+	case carbs:
+		return "carbs"
+	case salt:
+		return "salt"
+	}
+	return fmt.Sprintf("nutrient(%d)", int(n))
+}
+
+// set sets the figure for `which` in `n` to `grams`.
+func (n *Nutrition) set(which nutrient, grams float64) {
+	switch which {
+	case protein:
+		n.Protein = grams
+	case fat:
+		n.Fat = grams
+	case carbs:
+		n.Carbs = grams
+	case salt:
+		n.Salt = grams
+	}
+}
+
+// nutrientLabels are the words used for the nutrients in menu column headers and cells. Longer
+// labels come before the labels they contain.
+var nutrientLabels = []struct {
+	label    string
+	nutrient nutrient
+}{
+	{"たんぱく質", protein},
+	{"タンパク質", protein},
+	{"蛋白質", protein},
+	{"脂質", fat},
+	{"炭水化物", carbs},
+	{"食塩相当量", salt},
+	{"食塩", salt},
+	{"塩分", salt},
+}
+
+// headerNutrient returns the nutrient of column header `cell`, e.g. fat for "脂質(g)".
+func headerNutrient(cell string) (nutrient, bool) {
+	for _, l := range nutrientLabels {
+		if strings.Contains(cell, l.label) {
+			return l.nutrient, true
+		}
+	}
+	return 0, false
+}
+
+// parseGramsCell returns the grams in nutrient column cell `cell`, e.g. 25.3 for "25.3" or
+// "25.3g". ok is false if it is blank or not a figure.
+func parseGramsCell(cell string) (grams float64, ok bool) {
+	m := reGramsCell.FindStringSubmatch(cell)
+	if m == nil {
+		return 0, false
+	}
+	grams, err := strconv.ParseFloat(m[1], 64)
+	return grams, err == nil
+}
+
+// takeNutrientLabels sets the figures of the labelled nutrients in menu cell `cell`, like
+// "たんぱく質25.3g 脂質20g", in `n`. It returns `cell` without them.
+func takeNutrientLabels(cell string, n *Nutrition) string {
+	return reNutrientLabel.ReplaceAllStringFunc(cell, func(s string) string {
+		m := reNutrientLabel.FindStringSubmatch(s)
+		grams, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return s
+		}
+		which, _ := headerNutrient(m[1])
+		n.set(which, grams)
+		return " "
+	})
+}
+
+// reGramsCell matches a nutrient column cell. "ｇ" and "㌘" are turned into "g" and "グラム" by
+// normalize().
+var reGramsCell = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(?:g|グラム)?$`)
+
+// reNutrientLabel matches a labelled nutrient figure in a menu cell, e.g. "脂質20g" or "塩分:3.2g".
+var reNutrientLabel = regexp.MustCompile(`(たんぱく質|タンパク質|蛋白質|脂質|炭水化物|食塩相当量|食塩|塩分)\s*:?\s*(\d+(?:\.\d+)?)\s*(?:g|グラム)?`)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"log"
+)
+
+// showProgress turns on download progress logging. It is set by -progress.
+var showProgress = false
+
+// progressStep is how often, in bytes, progress is logged when the total size isn't known.
+const progressStep = 1 << 20
+
+// progressReader is an io.ReadCloser that logs how much of a download has been read. It logs
+// every 10% when the total size is known and every progressStep bytes otherwise.
+type progressReader struct {
+	rc         io.ReadCloser
+	name       string
+	total      int64 // bytes expected, or -1 if unknown
+	read       int64
+	reported   int64 // read as of the last report
+	nextReport int64
+}
+
+// newProgressReader returns a progressReader for `rc`, which should have `total` bytes, or -1 if
+// that isn't known. Progress is logged with `name`.
+func newProgressReader(rc io.ReadCloser, name string, total int64) *progressReader {
+	p := &progressReader{rc: rc, name: name, total: total}
+	p.nextReport = p.step()
+	return p
+}
+
+func (p *progressReader) step() int64 {
+	if p.total > 0 {
+		return (p.total + 9) / 10
+	}
+	return progressStep
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.rc.Read(b)
+	p.read += int64(n)
+	if p.read >= p.nextReport || (err == io.EOF && p.read > p.reported) {
+		p.report()
+		for p.nextReport <= p.read {
+			p.nextReport += p.step()
+		}
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.rc.Close()
+}
+
+func (p *progressReader) report() {
+	p.reported = p.read
+	if p.total > 0 {
+		log.Printf("%s: %d of %d KB (%d%%)", p.name, p.read>>10, p.total>>10, 100*p.read/p.total)
+	} else {
+		log.Printf("%s: %d KB", p.name, p.read>>10)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/common"
+)
+
+// runIDEnv is the environment variable that passes a run ID to the pipeline, e.g. from `watch` to
+// the child process of each cycle.
+const runIDEnv = "DORM_RUN_ID"
+
+// newRunID returns an ID for one run: its UTC start time and a random suffix, e.g.
+// 20240401T060000Z-1a2b3c4d.
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// setupRunID returns the run ID from $DORM_RUN_ID, or a new one if it isn't set, and prefixes every
+// log line with it so that all the messages from one run can be found together.
+func setupRunID() string {
+	runID := os.Getenv(runIDEnv)
+	if runID == "" {
+		runID = newRunID()
+	}
+	log.SetPrefix("[" + runID + "] ")
+	return runID
+}
+
+// uniDocLogger is a UniDoc logger that writes the library's messages at or below `level` through
+// the standard logger, so that they get the run ID prefix too. UniDoc's own WriterLogger can't be
+// used for this: it mangles the format arguments.
+type uniDocLogger struct {
+	level common.LogLevel
+}
+
+// newUniDocLogger returns a uniDocLogger for messages at or below `level`.
+func newUniDocLogger(level common.LogLevel) common.Logger {
+	return uniDocLogger{level: level}
+}
+
+func (l uniDocLogger) logf(level common.LogLevel, tag, format string, args ...interface{}) {
+	if l.level >= level {
+		log.Printf(tag+" "+format, args...)
+	}
+}
+
+func (l uniDocLogger) Error(format string, args ...interface{}) {
+	l.logf(common.LogLevelError, "[ERROR]", format, args...)
+}
+
+func (l uniDocLogger) Warning(format string, args ...interface{}) {
+	l.logf(common.LogLevelWarning, "[WARNING]", format, args...)
+}
+
+func (l uniDocLogger) Notice(format string, args ...interface{}) {
+	l.logf(common.LogLevelNotice, "[NOTICE]", format, args...)
+}
+
+func (l uniDocLogger) Info(format string, args ...interface{}) {
+	l.logf(common.LogLevelInfo, "[INFO]", format, args...)
+}
+
+func (l uniDocLogger) Debug(format string, args ...interface{}) {
+	l.logf(common.LogLevelDebug, "[DEBUG]", format, args...)
+}
+
+func (l uniDocLogger) Trace(format string, args ...interface{}) {
+	l.logf(common.LogLevelTrace, "[TRACE]", format, args...)
+}
+
+func (l uniDocLogger) IsLogLevel(level common.LogLevel) bool {
+	return l.level >= level
+}
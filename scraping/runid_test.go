@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/unidoc/unipdf/v3/common"
+)
+
+func TestNewRunID(t *testing.T) {
+	a, b := newRunID(), newRunID()
+	if !regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`).MatchString(a) {
+		t.Errorf("newRunID() = %q, want like 20240401T060000Z-1a2b3c4d", a)
+	}
+	if a == b {
+		t.Errorf("newRunID() returned %q twice", a)
+	}
+}
+
+func TestSetupRunIDPrefixesEveryLine(t *testing.T) {
+	logs := captureLog(t)
+	logger := common.Log
+	defer common.SetLogger(logger)
+
+	const runID = "20240401T060000Z-1a2b3c4d"
+	t.Setenv(runIDEnv, runID)
+	if got := setupRunID(); got != runID {
+		t.Errorf("setupRunID() = %q, want %q from $%s", got, runID, runIDEnv)
+	}
+
+	// A run logs through both the standard logger and UniDoc's.
+	common.SetLogger(newUniDocLogger(common.LogLevelInfo))
+	log.Println("Downloading Domitory Meal HTML File...")
+	common.Log.Info("Skipping %d of %d: %q", 1, 2, "PDF/2024PDF/apr.pdf")
+	log.Printf("warning: %s", "no link for 2024/10 found")
+	common.Log.Debug("not logged at the info level")
+
+	lines := strings.Split(strings.TrimSuffix(logs.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d log lines, want 3:\n%s", len(lines), logs.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "["+runID+"] ") {
+			t.Errorf("log line %q doesn't start with the run ID", line)
+		}
+	}
+	if !strings.Contains(lines[1], `[INFO]`) || !strings.Contains(lines[1], `Skipping 1 of 2: "PDF/2024PDF/apr.pdf"`) {
+		t.Errorf("UniDoc line = %q", lines[1])
+	}
+}
+
+func TestSetupRunIDNewID(t *testing.T) {
+	captureLog(t)
+	t.Setenv(runIDEnv, "")
+	runID := setupRunID()
+	if runID == "" || log.Prefix() != "["+runID+"] " {
+		t.Errorf("setupRunID() = %q with prefix %q, want a new ID as the prefix", runID, log.Prefix())
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Config describes an S3-compatible bucket to upload outputs to.
+type s3Config struct {
+	Endpoint  string // e.g. "https://s3.ap-northeast-1.amazonaws.com" or "http://localhost:9000"
+	Bucket    string
+	Prefix    string // key prefix that the output directory layout is placed under
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// s3ConfigFromEnv returns the S3 upload configuration from the S3_ENDPOINT, S3_BUCKET, S3_PREFIX,
+// S3_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func s3ConfigFromEnv() (s3Config, error) {
+	cfg := s3Config{
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Prefix:    os.Getenv("S3_PREFIX"),
+		Region:    os.Getenv("S3_REGION"),
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	var missing []string
+	for name, value := range map[string]string{
+		"S3_ENDPOINT":           cfg.Endpoint,
+		"S3_BUCKET":             cfg.Bucket,
+		"AWS_ACCESS_KEY_ID":     cfg.AccessKey,
+		"AWS_SECRET_ACCESS_KEY": cfg.SecretKey,
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return cfg, fmt.Errorf("S3 upload needs %s", strings.Join(missing, ", "))
+	}
+	return cfg, nil
+}
+
+// uploadOutputs uploads every CSV, JSON and text file under `outDir` to the bucket in `cfg`, keyed
+// by its path relative to `outDir` so the year/month layout is preserved. Local files are never
+// modified. Failed uploads are logged and reported together in the returned error. The uploads
+// stop when `ctx` is done.
+func uploadOutputs(ctx context.Context, cfg s3Config, outDir string) error {
+	var failed []string
+	uploaded := 0
+	err := filepath.Walk(outDir, func(filename string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv", ".json", ".txt":
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(outDir, filename)
+		if err != nil {
+			return err
+		}
+		key := path.Join(cfg.Prefix, filepath.ToSlash(rel))
+		if err := cfg.putFile(ctx, key, filename); err != nil {
+			log.Printf("Upload of %q failed: %v", filename, err)
+			failed = append(failed, filename)
+			return nil
+		}
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded %d files to s3://%s/%s", uploaded, cfg.Bucket, cfg.Prefix)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d uploads failed, local copies kept: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// putFile uploads file `filename` to object `key` with a SigV4-signed PUT.
+func (cfg s3Config) putFile(ctx context.Context, key, filename string) error {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return err
+	}
+	// Path-style addressing works with both AWS and self-hosted servers like MinIO.
+	escapedPath := "/" + s3Escape(cfg.Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint.Scheme+"://"+endpoint.Host+escapedPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeFor(filename))
+	cfg.sign(req, escapedPath, body, time.Now().UTC())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s: %s %s", key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to `req`, whose escaped path is `escapedPath`. The
+// host and every header already set on `req`, like Content-Type, are signed.
+func (cfg s3Config) sign(req *http.Request, escapedPath string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	values := map[string]string{"host": req.URL.Host}
+	for name, v := range req.Header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{
+		req.Method,
+		escapedPath,
+		"", // no query string
+	}
+	for _, name := range names {
+		lines = append(lines, name+":"+values[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+	lines = append(lines, "", signedHeaders, payloadHash)
+	canonicalRequest := strings.Join(lines, "\n")
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape percent-encodes `key` as S3 expects in a canonical URI: everything except unreserved
+// characters and "/" is encoded.
+func s3Escape(key string) string {
+	var sb strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// contentTypeFor returns the Content-Type to upload file `filename` with.
+func contentTypeFor(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "text/csv; charset=utf-8"
+	case ".json":
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// snapshotPDFPaths returns the local paths under `PDFRoot` of the PDFs linked from the saved
+// ryoushoku*.html menu pages in `snapshotDir`, so archived menus can be extracted without touching
+// the network. Linked PDFs that aren't archived locally are logged and skipped. The returned map
+// gives the URL under `url` each local path would have been downloaded from.
+func snapshotPDFPaths(snapshotDir, url, PDFRoot string) ([]string, map[string]string, error) {
+	htmlPaths, err := filepath.Glob(filepath.Join(snapshotDir, "ryoushoku*.html"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(htmlPaths) == 0 {
+		return nil, nil, fmt.Errorf("%w: no ryoushoku*.html snapshots in %q", errNoMenu, snapshotDir)
+	}
+
+	var localPDFFilePath []string
+	sourceURLs := make(map[string]string)
+	for _, htmlPath := range htmlPaths {
+		fileInfos, err := ioutil.ReadFile(htmlPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		links, err := getPDFLinks(&fileInfos)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", htmlPath, err)
+		}
+		for _, remotePDFPath := range pdfLinkPaths(links) {
+			PDFUrl, relPath := makeFullPath(url, remotePDFPath)
+			localPath, err := localPDFPath(PDFRoot, relPath)
+			if err != nil {
+				log.Printf("warning: %s: skipping link %q: %v", htmlPath, remotePDFPath, err)
+				continue
+			}
+			if _, seen := sourceURLs[localPath]; seen {
+				continue
+			}
+			sourceURLs[localPath] = PDFUrl
+			if _, err := os.Stat(localPath); err != nil {
+				log.Printf("%s: %s is not archived locally, skipping", htmlPath, localPath)
+				continue
+			}
+			localPDFFilePath = append(localPDFFilePath, localPath)
+		}
+	}
+	return localPDFFilePath, sourceURLs, nil
+}
+
+// localPDFPaths returns the PDF files already downloaded under `PDFRoot`.
+func localPDFPaths(PDFRoot string) ([]string, error) {
+	localPDFFilePath, err := patternsToPaths([]string{filepath.Join(PDFRoot, "**", "*.pdf")})
+	if err != nil {
+		return nil, err
+	}
+	if len(localPDFFilePath) == 0 {
+		return nil, fmt.Errorf("%w: no local PDF files under %q", errNoMenu, PDFRoot)
+	}
+	return localPDFFilePath, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes `files`, a map from slash-separated paths under `dir` to their contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotPDFPaths(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	snapshotDir := filepath.Join(dir, "html")
+	PDFRoot := filepath.Join(dir, "PDF")
+	writeFiles(t, dir, map[string]string{
+		"html/ryoushokuApril.html": menuPage("2024PDF/apr.pdf"),
+		// May's page still links to April, which is only listed once.
+		"html/ryoushokuMay.html":  menuPage("2024PDF/may.pdf", "./2024PDF/apr.pdf", "2024PDF/jun.pdf"),
+		"html/index.html":         menuPage("2024PDF/oct.pdf"),
+		"html/ryoushokuJune.html": menuPage("%2e%2e/%2e%2e/evil.pdf"),
+		"evil.pdf":                fakePDF,
+		"PDF/2024PDF/apr.pdf":     fakePDF,
+		"PDF/2024PDF/may.pdf":     fakePDF,
+		"PDF/2024PDF/oct.pdf":     fakePDF,
+	})
+
+	const url = "https://example.com/kondate/"
+	paths, sourceURLs, err := snapshotPDFPaths(snapshotDir, url, PDFRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apr := filepath.Join(PDFRoot, "2024PDF", "apr.pdf")
+	may := filepath.Join(PDFRoot, "2024PDF", "may.pdf")
+	jun := filepath.Join(PDFRoot, "2024PDF", "jun.pdf")
+	if want := []string{apr, may}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("snapshotPDFPaths = %q, want %q", paths, want)
+	}
+	wantURLs := map[string]string{
+		apr: url + "2024PDF/apr.pdf",
+		may: url + "2024PDF/may.pdf",
+		jun: url + "2024PDF/jun.pdf",
+	}
+	if !reflect.DeepEqual(sourceURLs, wantURLs) {
+		t.Errorf("source URLs = %q, want %q", sourceURLs, wantURLs)
+	}
+	if !strings.Contains(logs.String(), jun+" is not archived locally") {
+		t.Errorf("missing jun.pdf not logged: %q", logs.String())
+	}
+}
+
+func TestSnapshotPDFPathsNoSnapshots(t *testing.T) {
+	_, _, err := snapshotPDFPaths(t.TempDir(), "https://example.com/kondate/", t.TempDir())
+	if !errors.Is(err, errNoMenu) {
+		t.Errorf("snapshotPDFPaths of an empty directory = %v, want errNoMenu", err)
+	}
+}
+
+func TestLocalPDFPaths(t *testing.T) {
+	// The PDFs checked in under PDF/ are the offline fixture.
+	got, err := localPDFPaths("PDF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, mon := range []string{"apr", "jul", "jun", "may", "oct", "sep"} {
+		want = append(want, filepath.Join("PDF", "2024PDF", mon+".pdf"))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("localPDFPaths = %q, want %q", got, want)
+	}
+}
+
+func TestLocalPDFPathsNone(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"2024PDF/apr.pdf.part": "%PDF-1.4\n"})
+	if _, err := localPDFPaths(dir); !errors.Is(err, errNoMenu) {
+		t.Errorf("localPDFPaths with no PDFs = %v, want errNoMenu", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// String returns `t` as a grid with each column padded to its widest cell, for eyeballing tables
+// in logs. Wide CJK glyphs count as two columns so the grid lines up in a monospace terminal.
+func (t stringTable) String() string {
+	var colWidths []int
+	for _, row := range t {
+		for x, cell := range row {
+			if x >= len(colWidths) {
+				colWidths = append(colWidths, 0)
+			}
+			if w := displayWidth(cell); w > colWidths[x] {
+				colWidths[x] = w
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range t {
+		sb.WriteString("|")
+		for x, w := range colWidths {
+			cell := ""
+			if x < len(row) {
+				cell = row[x]
+			}
+			sb.WriteString(" ")
+			sb.WriteString(cell)
+			sb.WriteString(strings.Repeat(" ", w-displayWidth(cell)))
+			sb.WriteString(" |")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// displayWidth returns the number of monospace columns `s` occupies.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringTableStringAlignsMixedWidth(t *testing.T) {
+	table := stringTable{
+		{"date", "朝食", "kcal"},
+		{"4/1", "パン、牛乳", "650"},
+		{"4/2", "rice"},
+	}
+	want := "" +
+		"| date | 朝食       | kcal |\n" +
+		"| 4/1  | パン、牛乳 | 650  |\n" +
+		"| 4/2  | rice       |      |\n"
+	got := table.String()
+	if got != want {
+		t.Fatalf("String() =\n%s\nwant\n%s", got, want)
+	}
+	// In a monospace terminal every line is as wide and the column separators line up.
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	for _, line := range lines[1:] {
+		if displayWidth(line) != displayWidth(lines[0]) {
+			t.Errorf("line %q is %d columns wide, want %d", line, displayWidth(line), displayWidth(lines[0]))
+		}
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"朝食", 4},
+		{"ｶﾚｰ", 3}, // half-width katakana
+		{"ＡＢ", 4},  // full-width letters
+		{"4/1 パン", 8},
+	}
+	for _, tc := range tests {
+		if got := displayWidth(tc.s); got != tc.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// verifyCommand implements the `verify` subcommand. It checks every CSV file matched by the
+// patterns in `args` (or every CSV under -csvdir when none are given) and returns an error if
+// any of them fail verifyCSV() or, with -golden, differ from their golden copy as by
+// compareGolden().
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dir := fs.String("csvdir", "./outcsv", "directory searched for CSV files when no patterns are given")
+	golden := fs.String("golden", "", "directory of known-good CSV files, laid out as -csvdir, that each CSV must match")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s verify [-csvdir dir] [-golden dir] [pattern ...]\n", filepath.Base(flag.CommandLine.Name()))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{filepath.Join(*dir, "**", "*.csv")}
+	}
+	pathList, err := patternsToPaths(patterns)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range pathList {
+		err := verifyCSV(path)
+		if err == nil && *golden != "" {
+			err = compareGolden(path, goldenPath(*dir, *golden, path))
+		}
+		if err != nil {
+			log.Printf("FAIL %q: %v", path, err)
+			failed++
+		}
+	}
+	log.Printf("%d of %d CSV files failed verification", failed, len(pathList))
+	if failed > 0 {
+		return fmt.Errorf("%d CSV files failed verification", failed)
+	}
+	return nil
+}
+
+// verifyCSV returns an error if CSV file `path` isn't clean UTF-8 or doesn't have the same number
+// of columns in every row.
+func verifyCSV(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !utf8.Valid(data) {
+		return fmt.Errorf("invalid UTF-8")
+	}
+	if bytes.ContainsRune(data, utf8.RuneError) {
+		return fmt.Errorf("contains U+FFFD replacement characters")
+	}
+	// FieldsPerRecord = 0 makes the reader require every row to be as wide as the first.
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 0
+	if _, err := r.ReadAll(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// goldenPath returns the path under golden directory `golden` of the copy of CSV file `path`:
+// its path relative to `csvDir`, or just its name if it isn't under `csvDir`.
+func goldenPath(csvDir, golden, path string) string {
+	rel, err := filepath.Rel(csvDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(golden, rel)
+}
+
+// compareGolden returns an error describing the first difference between the tables in CSV file
+// `path` and its golden copy `goldenPath`, as found by EqualTables.
+func compareGolden(path, goldenPath string) error {
+	table, err := readCSVTable(path)
+	if err != nil {
+		return err
+	}
+	golden, err := readCSVTable(goldenPath)
+	if err != nil {
+		return fmt.Errorf("golden copy: %w", err)
+	}
+	if equal, diff := EqualTables(table, golden); !equal {
+		return fmt.Errorf("differs from %s: %s", goldenPath, diff)
+	}
+	return nil
+}
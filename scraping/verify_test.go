@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string // "" if the file is fine
+	}{
+		{"clean", "日付,朝食\n4/1,パン\n", ""},
+		{"quoted line break", "日付,朝食\n4/1,\"パン\n牛乳\"\n", ""},
+		{"ragged row", "日付,朝食\n4/1\n", "wrong number of fields"},
+		{"invalid UTF-8", "日付,朝食\n4/1,\xe3\x83\n", "invalid UTF-8"},
+		{"Shift_JIS", "\x93\xfa\x95t,\x92\xa9\x90H\n", "invalid UTF-8"},
+		{"replacement character", "日付,朝食\n4/1,�ン\n", "U+FFFD"},
+		{"bare quote", "日付,朝食\n4/1,\"パン\n", "extraneous or missing \" in quoted-field"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "apr.page1.table1.csv")
+			if err := os.WriteFile(path, []byte(tc.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := verifyCSV(path)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("verifyCSV = %v, want nil", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("verifyCSV = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCommandReportsCorruptCSV(t *testing.T) {
+	logs := captureLog(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"2024PDF/apr/apr.page1.table1.csv": "日付,朝食\n4/1,パン\n",
+		"2024PDF/apr/apr.page1.table2.csv": "日付,朝食\n4/1\n",
+		"2024PDF/may/may.page1.table1.csv": "日付,朝食\n5/1,ご飯\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := verifyCommand([]string{"-csvdir", dir})
+	if err == nil || !strings.Contains(err.Error(), "1 CSV files failed") {
+		t.Errorf("verifyCommand = %v, want 1 failed file", err)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "FAIL") || !strings.Contains(out, "apr.page1.table2.csv") {
+		t.Errorf("corrupt file not reported in the log:\n%s", out)
+	}
+	if strings.Contains(out, "table1.csv") {
+		t.Errorf("clean file reported in the log:\n%s", out)
+	}
+	if !strings.Contains(out, "1 of 3 CSV files failed verification") {
+		t.Errorf("summary missing from the log:\n%s", out)
+	}
+}
+
+func TestVerifyCommandGolden(t *testing.T) {
+	logs := captureLog(t)
+	dir, golden := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"2024PDF/apr/apr.page1.table1.csv": "日付,朝食\n4/1,パン\n",
+		"2024PDF/apr/apr.page1.table2.csv": "日付,朝食\n4/2,ご飯\n",
+		"2024PDF/may/may.page1.table1.csv": "日付,朝食\n5/1,ご飯\n",
+	})
+	writeFiles(t, golden, map[string]string{
+		// Matches after normalize().
+		"2024PDF/apr/apr.page1.table1.csv": "日付,朝食\n４/１,パン\n",
+		"2024PDF/apr/apr.page1.table2.csv": "日付,朝食\n4/2,パン\n",
+	})
+
+	err := verifyCommand([]string{"-csvdir", dir, "-golden", golden})
+	if err == nil || !strings.Contains(err.Error(), "2 CSV files failed") {
+		t.Errorf("verifyCommand = %v, want 2 failed files", err)
+	}
+	out := logs.String()
+	for _, want := range []string{
+		`apr.page1.table2.csv": differs from ` + filepath.Join(golden, "2024PDF", "apr", "apr.page1.table2.csv") +
+			`: cell[1][1] "ご飯" != "パン"`,
+		`may.page1.table1.csv": golden copy: `,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log = %s\nwant it to contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "apr.page1.table1.csv") {
+		t.Errorf("matching file reported in the log:\n%s", out)
+	}
+}
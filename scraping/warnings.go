@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+)
+
+// The codes of the parseWarnings.
+const (
+	warnOtherMonthDate     = "other-month-date"    // a column of a row of dates is another month's
+	warnCalorieRange       = "calorie-range"       // a meal's calories are a range, so not recorded
+	warnUnreadableCalories = "unreadable-calories" // a calorie column cell isn't a figure
+	warnUnreadableNutrient = "unreadable-nutrient" // a nutrient column cell isn't a figure
+)
+
+// parseWarning is a place where ParseMeals was unsure how to read a menu, for staff checking a
+// month's meals.
+type parseWarning struct {
+	page    int    // page number of the table; 0 if unknown
+	table   int    // table number on the page, starting at 1; 0 if unknown
+	code    string // what was uncertain, e.g. warnCalorieRange
+	message string
+}
+
+// mealWarnings collects the parseWarnings of the menu tables of a document as they are parsed.
+type mealWarnings struct {
+	page, table int // of the table being parsed
+	list        []parseWarning
+}
+
+// warn logs the warning of `code` with message `format` and `args` for the table being parsed,
+// and collects it. A nil `w` only logs it.
+func (w *mealWarnings) warn(code, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if w == nil {
+		log.Printf("warning: %s", message)
+		return
+	}
+	log.Printf("warning: page %d table %d: %s", w.page, w.table, message)
+	w.list = append(w.list, parseWarning{page: w.page, table: w.table, code: code, message: message})
+}
+
+// saveWarnings writes `warnings` to <csvRoot>.warnings.csv, a row of page, table, code and
+// message for each under a header row. The header is written even if there are no warnings, which
+// shows the month was parsed without any.
+func saveWarnings(csvRoot string, warnings []parseWarning) error {
+	warningsPath := csvRoot + ".warnings.csv"
+	t := stringTable{{"page", "table", "code", "message"}}
+	for _, w := range warnings {
+		t = append(t, []string{strconv.Itoa(w.page), strconv.Itoa(w.table), w.code, w.message})
+	}
+	b := new(bytes.Buffer)
+	if err := WriteCSV(b, t); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(warningsPath, b.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write warningsPath=%q err=%w", warningsPath, err)
+	}
+	return nil
+}
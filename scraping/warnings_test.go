@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMealsWarnings(t *testing.T) {
+	logs := captureLog(t)
+	r := docTables{
+		pageTables: map[int][]stringTable{
+			1: {
+				{{"令和6年4月の献立"}},
+				{
+					{"日付", "昼食", "カロリー", "夕食", "塩分"},
+					{"1", "カレー", "750", "焼き魚", "2.5"},
+					{"2", "うどん 500~600kcal", "", "ハンバーグ", "少なめ"},
+					{"3", "ラーメン", "多め", "休み", "-"},
+				},
+			},
+			2: {{
+				{"", "3/31", "4/4"},
+				{"朝食", "パン", "ご飯"},
+			}},
+		},
+		year:  2024,
+		month: time.April,
+	}
+	meals, warnings, err := ParseMeals(r, MealOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meals) != 7 {
+		t.Errorf("got %d meals, want 7: %v", len(meals), summarizeMeals(meals))
+	}
+	want := []parseWarning{
+		{1, 2, warnCalorieRange, `2024-04-02 lunch calories "500~600kcal" are a range, not recorded`},
+		{1, 2, warnUnreadableNutrient, `2024-04-02 dinner salt "少なめ" isn't a figure`},
+		{1, 2, warnUnreadableCalories, `2024-04-03 lunch calories "多め" aren't a figure`},
+		{2, 1, warnOtherMonthDate, `date "3/31" in a row of dates isn't in April, skipping its column`},
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings =\n%+v\nwant\n%+v", warnings, want)
+	}
+	if line := "warning: page 2 table 1: date \"3/31\""; !strings.Contains(logs.String(), line) {
+		t.Errorf("log = %q, want it to contain %q", logs, line)
+	}
+
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	if err := saveWarnings(csvRoot, warnings); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(csvRoot + ".warnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "page,table,code,message\n" +
+		`1,2,calorie-range,"2024-04-02 lunch calories ""500~600kcal"" are a range, not recorded"` + "\n" +
+		`1,2,unreadable-nutrient,"2024-04-02 dinner salt ""少なめ"" isn't a figure"` + "\n" +
+		`1,2,unreadable-calories,"2024-04-03 lunch calories ""多め"" aren't a figure"` + "\n" +
+		`2,1,other-month-date,"date ""3/31"" in a row of dates isn't in April, skipping its column"` + "\n"
+	if string(got) != wantCSV {
+		t.Errorf("warnings.csv =\n%s\nwant\n%s", got, wantCSV)
+	}
+}
+
+func TestSaveWarningsNone(t *testing.T) {
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	if err := saveWarnings(csvRoot, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(csvRoot + ".warnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "page,table,code,message\n"; string(got) != want {
+		t.Errorf("warnings.csv = %q, want just the header %q", got, want)
+	}
+}
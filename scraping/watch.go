@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// watchStopDelay is how long watch waits for a running cycle to exit after an interrupt before
+// killing it.
+const watchStopDelay = 30 * time.Second
+
+// watchCommand implements the `watch` subcommand. It runs the normal pipeline, with the remaining
+// arguments as its flags, once at startup and then every -interval until interrupted.
+func watchCommand(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 6*time.Hour, "time between runs")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s watch [-interval d] [pipeline flags...]\n", filepath.Base(flag.CommandLine.Name()))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *interval <= 0 {
+		return fmt.Errorf("-interval must be positive, got %s", *interval)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	pipelineArgs := fs.Args()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	log.Printf("watch: running every %s", *interval)
+	watch(ctx, ticker.C, func(ctx context.Context) error {
+		runID := newRunID()
+		log.Printf("watch: starting run %s", runID)
+		return runPipelineProcess(ctx, exe, pipelineArgs, runID)
+	})
+	log.Println("watch: stopped")
+	return nil
+}
+
+// watch calls `runCycle` once immediately and then on every value from `tick` until `ctx` is
+// done. A tick that arrives while the previous cycle is still running is skipped so that runs
+// never overlap. watch waits for the running cycle, if any, before returning.
+func watch(ctx context.Context, tick <-chan time.Time, runCycle func(ctx context.Context) error) {
+	done := make(chan struct{})
+	running := false
+	cycle := 0
+	start := func() {
+		running = true
+		cycle++
+		go func(cycle int) {
+			t0 := time.Now()
+			err := runCycle(ctx)
+			if err != nil {
+				log.Printf("watch: cycle %d failed after %s: %v", cycle, time.Since(t0).Round(time.Second), err)
+			} else {
+				log.Printf("watch: cycle %d finished in %s", cycle, time.Since(t0).Round(time.Second))
+			}
+			done <- struct{}{}
+		}(cycle)
+	}
+
+	start()
+	for {
+		select {
+		case <-ctx.Done():
+			if running {
+				<-done
+			}
+			return
+		case <-done:
+			running = false
+		case <-tick:
+			if running {
+				log.Printf("watch: cycle %d still running, skipping this tick", cycle)
+				continue
+			}
+			start()
+		}
+	}
+}
+
+// runPipelineProcess runs one pipeline cycle as a child process of `exe` with `args`, so that a
+// fatal error in the cycle doesn't end the watch. The child is interrupted when `ctx` is done and
+// killed if it hasn't exited within watchStopDelay. The child logs with run ID `runID`.
+func runPipelineProcess(ctx context.Context, exe string, args []string, runID string) error {
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Env = append(os.Environ(), runIDEnv+"="+runID)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = watchStopDelay
+	return cmd.Run()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchSkipsOverlappingTicksAndStopsOnCancel(t *testing.T) {
+	captureLog(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tick := make(chan time.Time) // the fake clock
+	starts := make(chan int, 10)
+	release := make(chan struct{})
+	running, maxRunning := 0, 0
+	cycles := 0
+	cycleCanceled := make(chan bool, 10)
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		watch(ctx, tick, func(ctx context.Context) error {
+			// watch runs at most one cycle at a time, so these need no lock if it is right; the
+			// race detector reports it if not.
+			cycles++
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			starts <- cycles
+			select {
+			case <-release:
+				cycleCanceled <- false
+			case <-ctx.Done():
+				cycleCanceled <- true
+			}
+			running--
+			return ctx.Err()
+		})
+	}()
+
+	if n := <-starts; n != 1 {
+		t.Fatalf("first cycle = %d, want 1", n)
+	}
+	// Ticks while cycle 1 runs are skipped.
+	for i := 0; i < 3; i++ {
+		tick <- time.Time{}
+	}
+	select {
+	case n := <-starts:
+		t.Fatalf("cycle %d started while cycle 1 was running", n)
+	default:
+	}
+
+	// Once cycle 1 is done, a tick starts cycle 2. Ticks that arrive before watch sees cycle 1
+	// finish are skipped too, so keep ticking until it starts.
+	release <- struct{}{}
+	func() {
+		for {
+			select {
+			case tick <- time.Time{}:
+			case n := <-starts:
+				if n != 2 {
+					t.Fatalf("second cycle = %d, want 2", n)
+				}
+				return
+			}
+		}
+	}()
+
+	// Canceling ends the running cycle and watch waits for it.
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't return after cancel")
+	}
+	if <-cycleCanceled {
+		t.Errorf("cycle 1 saw the cancel; want it released")
+	}
+	if !<-cycleCanceled {
+		t.Errorf("cycle 2 wasn't canceled")
+	}
+	if maxRunning != 1 {
+		t.Errorf("%d cycles ran at once, want 1", maxRunning)
+	}
+	if cycles != 2 {
+		t.Errorf("ran %d cycles, want 2", cycles)
+	}
+}
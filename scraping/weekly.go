@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mealWeek is the meals of one week, for the weekly digest.
+type mealWeek struct {
+	start time.Time // first day of the week, which may be before the first meal
+	meals []Meal    // in date order
+}
+
+// groupByWeek returns `meals` grouped into weeks starting on `weekStart`, in date order. The
+// meals of a day keep their order in `meals`. A week at the start or end of a month's menu is
+// partial, with only the days the menu has.
+func groupByWeek(meals []Meal, weekStart time.Weekday) []mealWeek {
+	sorted := append([]Meal(nil), meals...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	var weeks []mealWeek
+	for _, meal := range sorted {
+		back := (int(meal.Date.Weekday()) - int(weekStart) + 7) % 7
+		start := meal.Date.AddDate(0, 0, -back)
+		if len(weeks) == 0 || !weeks[len(weeks)-1].start.Equal(start) {
+			weeks = append(weeks, mealWeek{start: start})
+		}
+		weeks[len(weeks)-1].meals = append(weeks[len(weeks)-1].meals, meal)
+	}
+	return weeks
+}
+
+// weeksMarkdown returns the Markdown weekly digest of `weeks`: a section for each week headed
+// with the first and last days it has meals on, or its one day, and a list of each day's
+// dayLines under each of those days.
+func weeksMarkdown(weeks []mealWeek) string {
+	var b strings.Builder
+	for i, week := range weeks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		first, last := week.meals[0].Date, week.meals[len(week.meals)-1].Date
+		if first.Equal(last) {
+			fmt.Fprintf(&b, "## %s\n", japaneseDate(first))
+		} else {
+			fmt.Fprintf(&b, "## %s〜%s\n", japaneseDate(first), japaneseDate(last))
+		}
+		for start := 0; start < len(week.meals); {
+			end := start
+			for end < len(week.meals) && week.meals[end].Date.Equal(week.meals[start].Date) {
+				end++
+			}
+			fmt.Fprintf(&b, "\n### %s\n\n", japaneseDate(week.meals[start].Date))
+			for _, line := range dayLines(week.meals[start:end]) {
+				b.WriteString("- " + line + "\n")
+			}
+			start = end
+		}
+	}
+	return b.String()
+}
+
+// saveWeeks writes the weekly digest of `meals`, with weeks starting on `weekStart`, to
+// <csvRoot>.weeks.md.
+func saveWeeks(csvRoot string, meals []Meal, weekStart time.Weekday) error {
+	weeksPath := csvRoot + ".weeks.md"
+	if err := ioutil.WriteFile(weeksPath, []byte(weeksMarkdown(groupByWeek(meals, weekStart))), 0666); err != nil {
+		return fmt.Errorf("failed to write weeksPath=%q err=%w", weeksPath, err)
+	}
+	return nil
+}
+
+// parseWeekday returns the day of the week named by `s`, in English (Monday, mon) or Japanese
+// (月, 月曜日).
+func parseWeekday(s string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		english := strings.ToLower(day.String())
+		japanese := japaneseWeekdays[day]
+		if (len(name) >= 3 && strings.HasPrefix(english, name)) ||
+			name == japanese || name == japanese+"曜" || name == japanese+"曜日" {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a day of the week", s)
+}
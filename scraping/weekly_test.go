@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupByWeek(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	// April 2024 starts on a Monday and ends on a Tuesday.
+	meals := []Meal{
+		{Date: day(8), Type: Breakfast},
+		{Date: day(1), Type: Dinner},
+		{Date: day(1), Type: Breakfast},
+		{Date: day(7), Type: Lunch},
+		{Date: day(30), Type: Lunch},
+	}
+	// weekDays returns the days of the month of the meals of `weeks`, a slice for each week.
+	weekDays := func(weeks []mealWeek) [][]int {
+		var days [][]int
+		for _, week := range weeks {
+			var d []int
+			for _, meal := range week.meals {
+				d = append(d, meal.Date.Day())
+			}
+			days = append(days, d)
+		}
+		return days
+	}
+	tests := []struct {
+		weekStart time.Weekday
+		starts    []time.Time
+		days      [][]int
+	}{
+		{time.Monday, []time.Time{day(1), day(8), day(29)}, [][]int{{1, 1, 7}, {8}, {30}}},
+		// The first week starts in March, before the menu does.
+		{time.Sunday, []time.Time{day(0), day(7), day(28)}, [][]int{{1, 1}, {7, 8}, {30}}},
+	}
+	for _, tc := range tests {
+		weeks := groupByWeek(meals, tc.weekStart)
+		var starts []time.Time
+		for _, week := range weeks {
+			starts = append(starts, week.start)
+		}
+		if !reflect.DeepEqual(starts, tc.starts) {
+			t.Errorf("%s: week starts = %v, want %v", tc.weekStart, starts, tc.starts)
+		}
+		if got := weekDays(weeks); !reflect.DeepEqual(got, tc.days) {
+			t.Errorf("%s: week days = %v, want %v", tc.weekStart, got, tc.days)
+		}
+	}
+	// The meals of a day keep their order.
+	if weeks := groupByWeek(meals, time.Monday); weeks[0].meals[0].Type != Dinner || weeks[0].meals[1].Type != Breakfast {
+		t.Errorf("meals of April 1 reordered: %v", weeks[0].meals[:2])
+	}
+}
+
+func TestSaveWeeks(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.April, d, 0, 0, 0, 0, time.Local) }
+	meals := []Meal{
+		{Date: day(29), Type: Breakfast, Items: []string{"パン"}},
+		{Date: day(29), Type: Dinner, Items: []string{"カレー"}, Calories: 800, CaloriesOK: true},
+		{Date: day(30), Type: Lunch, Closed: true},
+		{Date: day(30), Type: Dinner, Closed: true},
+		{Date: day(27), Type: Lunch, Items: []string{"うどん"}},
+	}
+	csvRoot := filepath.Join(t.TempDir(), "apr")
+	if err := saveWeeks(csvRoot, meals, time.Monday); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(csvRoot + ".weeks.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## 4月27日(土)\n" +
+		"\n### 4月27日(土)\n\n" +
+		"- 朝食: なし\n- 昼食: うどん\n- 夕食: なし\n" +
+		"\n## 4月29日(月)〜4月30日(火)\n" +
+		"\n### 4月29日(月)\n\n" +
+		"- 朝食: パン\n- 昼食: なし\n- 夕食: カレー (800kcal)\n" +
+		"\n### 4月30日(火)\n\n" +
+		"- 本日休業\n"
+	if string(got) != want {
+		t.Errorf("weeks.md =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	for s, want := range map[string]time.Weekday{
+		"monday": time.Monday, "Mon": time.Monday, " sunday ": time.Sunday, "sat": time.Saturday,
+		"月": time.Monday, "日曜": time.Sunday, "土曜日": time.Saturday,
+	} {
+		if got, err := parseWeekday(s); err != nil || got != want {
+			t.Errorf("parseWeekday(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "mo", "someday", "金曜日s"} {
+		if _, err := parseWeekday(s); err == nil {
+			t.Errorf("parseWeekday(%q) succeeded", s)
+		}
+	}
+}